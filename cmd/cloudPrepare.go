@@ -70,4 +70,5 @@ func init() {
 	prepareCloudCmd.Flags().StringVarP(&robotId, "robot", "r", "", "The robot id to use as the download source.")
 	prepareCloudCmd.MarkFlagRequired("robot")
 	prepareCloudCmd.Flags().StringVarP(&common.HolotreeSpace, "space", "s", "user", "Client specific name to identify this environment.")
+	prepareCloudCmd.Flags().StringVarP(&common.HolotreeTarget, "target", "t", "", "Restore environment into this directory instead of holotree space location. <optional>")
 }
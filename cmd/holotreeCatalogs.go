@@ -87,6 +87,9 @@ func jsonCatalogDetails(roots []*htfs.Root) {
 			data["identity-content"] = identityContent(catalog)
 		}
 		data["platform"] = catalog.Platform
+		if len(catalog.Adopted) > 0 {
+			data["adopted"] = catalog.Adopted
+		}
 		data["directories"] = stats.Directories
 		data["files"] = stats.Files
 		data["bytes"] = stats.Bytes
@@ -103,8 +106,8 @@ func jsonCatalogDetails(roots []*htfs.Root) {
 func listCatalogDetails(roots []*htfs.Root) {
 	used := catalogUsedStats()
 	tabbed := tabwriter.NewWriter(os.Stderr, 2, 4, 2, ' ', 0)
-	tabbed.Write([]byte("Blueprint\tPlatform\tDirs  \tFiles  \tSize   \tidentity.yaml (gzipped blob inside hololib)\tHolotree path\tAge (days)\tIdle (days)\n"))
-	tabbed.Write([]byte("---------\t--------\t------\t-------\t-------\t-------------------------------------------\t-------------\t----------\t-----------\n"))
+	tabbed.Write([]byte("Blueprint\tPlatform\tDirs  \tFiles  \tSize   \tidentity.yaml (gzipped blob inside hololib)\tHolotree path\tAge (days)\tIdle (days)\tAdopted from\n"))
+	tabbed.Write([]byte("---------\t--------\t------\t-------\t-------\t-------------------------------------------\t-------------\t----------\t-----------\t------------\n"))
 	for _, catalog := range roots {
 		lastUse, ok := used[catalog.Blueprint]
 		if !ok {
@@ -114,7 +117,11 @@ func listCatalogDetails(roots []*htfs.Root) {
 		stats, err := catalog.Stats()
 		pretty.Guard(err == nil, 1, "Could not get stats for %s, reason: %s", catalog.Blueprint, err)
 		days, _ := pathlib.DaysSinceModified(catalog.Source())
-		data := fmt.Sprintf("%s\t%s\t% 6d\t% 7d\t% 6dM\t%s\t%s\t%10d\t%11d\n", catalog.Blueprint, catalog.Platform, stats.Directories, stats.Files, megas(stats.Bytes), stats.Identity, catalog.HolotreeBase(), days, lastUse)
+		adopted := "-"
+		if len(catalog.Adopted) > 0 {
+			adopted = catalog.Adopted
+		}
+		data := fmt.Sprintf("%s\t%s\t% 6d\t% 7d\t% 6dM\t%s\t%s\t%10d\t%11d\t%s\n", catalog.Blueprint, catalog.Platform, stats.Directories, stats.Files, megas(stats.Bytes), stats.Identity, catalog.HolotreeBase(), days, lastUse, adopted)
 		tabbed.Write([]byte(data))
 		if showIdentityYaml {
 			for _, line := range identityContentLines(catalog) {
@@ -133,7 +140,7 @@ var holotreeCatalogsCmd = &cobra.Command{
 		if common.DebugFlag {
 			defer common.Stopwatch("Holotree catalogs command lasted").Report()
 		}
-		_, roots := htfs.LoadCatalogs()
+		_, roots := htfs.LoadCatalogHeaders()
 		if jsonFlag {
 			jsonCatalogDetails(roots)
 		} else {
@@ -34,6 +34,9 @@ func checkHolotreeIntegrity() (err error) {
 	collector := make(map[string]string)
 	common.Timeline("holotree integrity collector")
 	err = fs.Treetop(htfs.IntegrityCheck(collector, needed))
+	fail.On(err != nil, "%s", err)
+	common.Timeline("holotree integrity packs")
+	err = htfs.VerifyPacked(needed)
 	common.Timeline("holotree integrity report")
 	fail.On(err != nil, "%s", err)
 	purge := make(map[string]bool)
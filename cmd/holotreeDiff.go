@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/htfs"
+	"github.com/robocorp/rcc/operations"
+	"github.com/robocorp/rcc/pretty"
+	"github.com/spf13/cobra"
+)
+
+var (
+	diffPackagesOnly bool
+)
+
+func diffMarker(status string) string {
+	switch status {
+	case htfs.DiffAdded:
+		return fmt.Sprintf("%s+%s", pretty.Green, pretty.Reset)
+	case htfs.DiffRemoved:
+		return fmt.Sprintf("%s-%s", pretty.Red, pretty.Reset)
+	default:
+		return fmt.Sprintf("%s~%s", pretty.Yellow, pretty.Reset)
+	}
+}
+
+func humaneHolotreeDiff(delta *htfs.CatalogDiff) {
+	tabbed := tabwriter.NewWriter(os.Stderr, 2, 4, 2, ' ', 0)
+	tabbed.Write([]byte(fmt.Sprintf("Before: %s [%s %s] %s\n", delta.Before.Name, delta.Before.Kind, delta.Before.Blueprint, delta.Before.Source)))
+	tabbed.Write([]byte(fmt.Sprintf("After:  %s [%s %s] %s\n", delta.After.Name, delta.After.Kind, delta.After.Blueprint, delta.After.Source)))
+	if !diffPackagesOnly {
+		tabbed.Write([]byte("\nStatus\tPath\tBefore\tAfter\n"))
+		tabbed.Write([]byte("------\t----\t------\t-----\n"))
+		for _, entry := range delta.Files {
+			before, after := "-", "-"
+			if entry.Before != nil {
+				before = entry.Before.String()
+			}
+			if entry.After != nil {
+				after = entry.After.String()
+			}
+			tabbed.Write([]byte(fmt.Sprintf("%s\t%s\t%s\t%s\n", diffMarker(entry.Status), entry.Path, before, after)))
+		}
+	}
+	tabbed.Write([]byte("\nStatus\tPackage\tChannel\tBefore\tAfter\n"))
+	tabbed.Write([]byte("------\t-------\t-------\t------\t-----\n"))
+	for _, change := range delta.Packages {
+		status := htfs.DiffChanged
+		if change.Added() {
+			status = htfs.DiffAdded
+		}
+		if change.Removed() {
+			status = htfs.DiffRemoved
+		}
+		tabbed.Write([]byte(fmt.Sprintf("%s\t%s\t%s\t%s\t%s\n", diffMarker(status), change.Name, change.Origin, change.Before, change.After)))
+	}
+	tabbed.Write([]byte("\n"))
+	tabbed.Flush()
+	files := delta.Files
+	common.Log("Files: %d added, %d removed, %d changed.", files.Count(htfs.DiffAdded), files.Count(htfs.DiffRemoved), files.Count(htfs.DiffChanged))
+	common.Log("Packages: %d differences.", len(delta.Packages))
+}
+
+var holotreeDiffCmd = &cobra.Command{
+	Use:   "diff <catalogA> <catalogB>",
+	Short: "Show differences between two holotree catalogs or spaces.",
+	Long: `Show differences between two holotree catalogs or spaces.
+
+Both arguments can be catalog names, blueprint hashes, space identities, space
+names, or filenames of catalog or space .meta files. Result lists added,
+removed, and changed files, and package level summary based on golden-ee.yaml
+dependency listings.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if common.DebugFlag {
+			defer common.Stopwatch("Holotree diff command lasted").Report()
+		}
+		before, err := htfs.ResolveDiffSide(args[0])
+		pretty.Guard(err == nil, 1, "%v", err)
+		after, err := htfs.ResolveDiffSide(args[1])
+		pretty.Guard(err == nil, 2, "%v", err)
+		delta := htfs.Diff(before, after)
+		if jsonFlag {
+			if diffPackagesOnly {
+				delta.Files = nil
+			}
+			content, err := operations.NiceJsonOutput(delta)
+			pretty.Guard(err == nil, 3, "%v", err)
+			common.Stdout("%s\n", content)
+		} else {
+			humaneHolotreeDiff(delta)
+		}
+		pretty.Ok()
+	},
+}
+
+func init() {
+	holotreeCmd.AddCommand(holotreeDiffCmd)
+	holotreeDiffCmd.Flags().BoolVarP(&jsonFlag, "json", "j", false, "Output in JSON format.")
+	holotreeDiffCmd.Flags().BoolVarP(&diffPackagesOnly, "packages", "p", false, "Show only package level differences.")
+}
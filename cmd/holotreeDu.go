@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/htfs"
+	"github.com/robocorp/rcc/operations"
+	"github.com/robocorp/rcc/pretty"
+	"github.com/spf13/cobra"
+)
+
+var (
+	duTop int
+)
+
+func humaneUsageEntries(tabbed *tabwriter.Writer, title string, entries htfs.UsageEntries) {
+	if len(entries) == 0 {
+		return
+	}
+	tabbed.Write([]byte(fmt.Sprintf("  %s\tFiles\tSize\n", title)))
+	for _, entry := range entries {
+		tabbed.Write([]byte(fmt.Sprintf("  %s\t%d\t% 6dM\n", entry.Name, entry.Files, megas(entry.Bytes))))
+	}
+}
+
+func humaneHolotreeDu(usage *htfs.DiskUsage) {
+	tabbed := tabwriter.NewWriter(os.Stderr, 2, 4, 2, ' ', 0)
+	tabbed.Write([]byte("Blueprint\tFiles\tSize\tUnique\tShared\n"))
+	tabbed.Write([]byte("---------\t-----\t----\t------\t------\n"))
+	for _, catalog := range usage.Catalogs {
+		tabbed.Write([]byte(fmt.Sprintf("%s\t%d\t% 6dM\t% 6dM\t% 6dM\n", catalog.Blueprint, catalog.Files, megas(catalog.Bytes), megas(catalog.Unique), megas(catalog.Shared))))
+		humaneUsageEntries(tabbed, "Package", catalog.Packages)
+		humaneUsageEntries(tabbed, "Directory", catalog.Directories)
+	}
+	if len(usage.Spaces) > 0 {
+		tabbed.Write([]byte("\nIdentity\tController\tSpace\tFiles\tSize\tDuplicated\n"))
+		tabbed.Write([]byte("--------\t----------\t-----\t-----\t----\t----------\n"))
+		for _, space := range usage.Spaces {
+			tabbed.Write([]byte(fmt.Sprintf("%s\t%s\t%s\t%d\t% 6dM\t% 6dM\n", space.Identity, space.Controller, space.Space, space.Files, megas(space.Bytes), megas(space.Duplicated))))
+		}
+	}
+	if len(usage.Duplicates) > 0 {
+		tabbed.Write([]byte("\nDigest\tCopies\tSize\tWasted\tExample\n"))
+		tabbed.Write([]byte("------\t------\t----\t------\t-------\n"))
+		for _, duplicate := range usage.Duplicates {
+			tabbed.Write([]byte(fmt.Sprintf("%s\t%d\t% 6dM\t% 6dM\t%s\n", duplicate.Digest, duplicate.Copies, megas(duplicate.Size), megas(duplicate.Wasted), duplicate.Paths[0])))
+		}
+	}
+	tabbed.Write([]byte("\n"))
+	tabbed.Flush()
+	common.Log("Catalogs reference %dM, hololib stores %dM (%dM shared), dedup ratio is %.2f.", megas(usage.Referenced), megas(usage.Stored), megas(usage.Shared), usage.Ratio)
+	common.Log("Spaces have %dM of duplicated content not deduplicated [hardlinks: %v].", megas(usage.Wasted), usage.Hardlinks)
+}
+
+var holotreeDuCmd = &cobra.Command{
+	Use:   "du",
+	Short: "Show disk usage of holotree catalogs and spaces.",
+	Long: `Show disk usage of holotree catalogs and spaces.
+
+For each catalog, largest packages and directories are listed, and content is
+split to bytes unique to that catalog and bytes shared with other catalogs.
+For spaces, sizes are listed together with content that is duplicated between
+(or within) spaces, but is not deduplicated on disk. All sizes are uncompressed
+sizes, as recorded in catalogs and space metadata.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if common.DebugFlag {
+			defer common.Stopwatch("Holotree du command lasted").Report()
+		}
+		usage := htfs.CalculateDiskUsage(duTop)
+		if jsonFlag {
+			content, err := operations.NiceJsonOutput(usage)
+			pretty.Guard(err == nil, 1, "%v", err)
+			common.Stdout("%s\n", content)
+		} else {
+			humaneHolotreeDu(usage)
+		}
+		pretty.Ok()
+	},
+}
+
+func init() {
+	holotreeCmd.AddCommand(holotreeDuCmd)
+	holotreeDuCmd.Flags().BoolVarP(&jsonFlag, "json", "j", false, "Output in JSON format.")
+	holotreeDuCmd.Flags().IntVarP(&duTop, "top", "", 10, "How many largest packages, directories, and duplicates to show.")
+}
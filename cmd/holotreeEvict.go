@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/htfs"
+	"github.com/robocorp/rcc/operations"
+	"github.com/robocorp/rcc/pretty"
+	"github.com/spf13/cobra"
+)
+
+var (
+	evictMaxSize int
+)
+
+func humaneHolotreeEvict(result *htfs.Eviction) {
+	for _, catalog := range result.Protected {
+		common.Log("Protected: %s", catalog)
+	}
+	for _, catalog := range result.Evicted {
+		common.Log("Evicted:   %s", catalog)
+	}
+	common.Log("Limit:     %dM", megas(result.Limit))
+	common.Log("Before:    %dM", megas(result.Before))
+	if result.Dryrun {
+		common.Log("Estimated: %dM", megas(result.After))
+	} else {
+		common.Log("After:     %dM", megas(result.After))
+	}
+	if result.Garbage != nil {
+		common.Log("Reclaimed: %d objects (%dM)", result.Garbage.Garbage, megas(result.Garbage.Reclaimed))
+	}
+}
+
+var holotreeEvictCmd = &cobra.Command{
+	Use:   "evict",
+	Short: "Remove least recently used catalogs until hololib fits into size limit.",
+	Long: `Remove least recently used catalogs until hololib fits into size limit.
+
+Catalogs are evicted in least recently used order, and after that library
+objects that are not referenced by remaining catalogs are garbage collected.
+Catalogs used by leased, running, or recently restored spaces are never
+evicted. Default limit comes from settings.yaml "max-hololib-size" option.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if common.DebugFlag {
+			defer common.Stopwatch("Holotree evict command lasted").Report()
+		}
+		limit := htfs.LibraryLimit()
+		if evictMaxSize > 0 {
+			limit = uint64(evictMaxSize) * mega
+		}
+		pretty.Guard(limit > 0, 1, "No hololib size limit given, use --max-size option or settings.yaml.")
+		result, err := htfs.EvictLibrary(limit, dryFlag)
+		pretty.Guard(err == nil, 2, "Eviction failed, reason: %v", err)
+		if jsonFlag {
+			content, err := operations.NiceJsonOutput(result)
+			pretty.Guard(err == nil, 3, "%v", err)
+			common.Stdout("%s\n", content)
+		} else {
+			humaneHolotreeEvict(result)
+		}
+		pretty.Guard(!result.Exceeded(), 4, "Hololib is still above size limit, rest of catalogs are in use.")
+		pretty.Ok()
+	},
+}
+
+func init() {
+	holotreeCmd.AddCommand(holotreeEvictCmd)
+	holotreeEvictCmd.Flags().IntVarP(&evictMaxSize, "max-size", "", 0, "Maximum hololib size in megabytes (overrides settings.yaml value).")
+	holotreeEvictCmd.Flags().BoolVarP(&dryFlag, "dry-run", "d", false, "Don't remove anything, just show what would be evicted.")
+	holotreeEvictCmd.Flags().BoolVarP(&jsonFlag, "json", "j", false, "Output in JSON format.")
+}
@@ -4,20 +4,24 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 
 	"github.com/robocorp/rcc/common"
 	"github.com/robocorp/rcc/htfs"
+	"github.com/robocorp/rcc/operations"
 	"github.com/robocorp/rcc/pretty"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v2"
 )
 
 var (
-	holozip     string
-	exportRobot string
-	specFile    string
+	holozip        string
+	exportRobots   []string
+	exportCondas   []string
+	specFile       string
+	standaloneFlag bool
 )
 
 type (
@@ -87,6 +91,67 @@ func holotreeExport(catalogs, known []string, archive string) {
 	pretty.Guard(err == nil, 3, "%s", err)
 }
 
+func exportStandalone(args []string) {
+	pretty.Guard(len(args) == 2, 10, "Option --standalone needs exactly two arguments: <space> and <archive.tar.gz>.")
+	spaces := htfs.FindSpaces(args[0])
+	pretty.Guard(len(spaces) > 0, 11, "Name %q does not match any space.", args[0])
+	pretty.Guard(len(spaces) == 1, 11, "Name %q matches multiple spaces: %s", args[0], strings.Join(spaces, ", "))
+	report, err := htfs.ExportStandalone(spaces[0], args[1])
+	pretty.Guard(err == nil, 12, "%v", err)
+	if jsonFlag {
+		content, err := operations.NiceJsonOutput(report)
+		pretty.Guard(err == nil, 13, "%v", err)
+		common.Stdout("%s\n", content)
+		return
+	}
+	common.Log("Exported space %q [%s] from %q to %q.", report.Space, report.Blueprint, report.Path, report.Archive)
+	common.Log("Archive has %d entries, %d of them need relocation, total %dM compressed.", report.Entries, report.Relocated, megas(report.Size))
+	common.Log("Unpack it with: tar -xzf %s -C <directory> and run rcc_unpack script in that directory.", filepath.Base(report.Archive))
+}
+
+func exportableCondafiles() []string {
+	result := make([]string, 0, len(exportRobots)+len(exportCondas))
+	for _, robotfile := range exportRobots {
+		_, condafiles := htfs.RobotBlueprints(nil, robotfile)
+		pretty.Guard(len(condafiles) == 1, 1, "Could not find environment configuration of robot %q.", robotfile)
+		result = append(result, condafiles[0])
+	}
+	return append(result, exportCondas...)
+}
+
+func exportableCatalog(condafile string) string {
+	_, holotreeBlueprint, err := htfs.ComposeFinalBlueprint([]string{condafile}, "")
+	pretty.Guard(err == nil, 1, "Blueprint calculation failed: %v", err)
+	return htfs.CatalogName(htfs.BlueprintHash(holotreeBlueprint))
+}
+
+func exportableCatalogs() []string {
+	condafiles := exportableCondafiles()
+	result := make([]string, 0, len(condafiles))
+	for _, condafile := range condafiles {
+		catalog := exportableCatalog(condafile)
+		_, _, err := htfs.NewEnvironment(condafile, "", false, false)
+		pretty.Guard(err == nil, 8, "Could not build environment for %q, reason: %v", condafile, err)
+		result = append(result, catalog)
+	}
+	return result
+}
+
+func unionCatalogs(groups ...[]string) []string {
+	seen := make(map[string]bool)
+	result := make([]string, 0, 10)
+	for _, group := range groups {
+		for _, catalog := range group {
+			if !seen[catalog] {
+				seen[catalog] = true
+				result = append(result, catalog)
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
 func listCatalogs(jsonForm bool) {
 	if jsonForm {
 		nice, err := json.MarshalIndent(htfs.Catalogs(), "", "  ")
@@ -131,25 +196,40 @@ func selectCatalogs(filters []string) []string {
 var holotreeExportCmd = &cobra.Command{
 	Use:   "export catalog+",
 	Short: "Export existing holotree catalog and library parts.",
-	Long:  "Export existing holotree catalog and library parts.",
+	Long: `Export existing holotree catalog and library parts.
+
+Catalogs can be selected by name (or substring of name), or by giving robot.yaml
+files with --robot, or conda.yaml files with --conda options, which can be used
+multiple times. Environments of those robots and conda files are built first,
+if they are missing from hololib. Archive will contain union of all selected
+catalogs and their deduplicated library objects.
+
+With --standalone option, arguments are space (identity or name) and name of
+tar.gz archive to create. That archive unpacks to working environment, which
+can be used without rcc: first run included rcc_unpack script (relocates
+environment to where it was unpacked), and then source activate script.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if common.DebugFlag {
 			defer common.Stopwatch("Holotree export command lasted").Report()
 		}
+		if standaloneFlag {
+			exportStandalone(args)
+			pretty.Ok()
+			return
+		}
 		if len(specFile) > 0 {
 			exportBySpecification(specFile)
 			return
 		}
-		if len(exportRobot) > 0 {
-			_, holotreeBlueprint, err := htfs.ComposeFinalBlueprint(nil, exportRobot)
-			pretty.Guard(err == nil, 1, "Blueprint calculation failed: %v", err)
-			hash := htfs.BlueprintHash(holotreeBlueprint)
-			args = append(args, htfs.CatalogName(hash))
-		}
-		if len(args) == 0 {
+		// environments built for export are evicted only after export is done
+		defer htfs.SuspendEviction()()
+		wanted := exportableCatalogs()
+		if len(args) == 0 && len(wanted) == 0 {
 			listCatalogs(jsonFlag)
 		} else {
-			holotreeExport(selectCatalogs(args), nil, holozip)
+			exact := selectExactCatalogs(wanted)
+			pretty.Guard(len(exact) == len(unionCatalogs(wanted)), 9, "Only %d out of %d needed catalogs available. Quitting!", len(exact), len(unionCatalogs(wanted)))
+			holotreeExport(unionCatalogs(selectCatalogs(args), exact), nil, holozip)
 		}
 		pretty.Ok()
 	},
@@ -158,7 +238,9 @@ var holotreeExportCmd = &cobra.Command{
 func init() {
 	holotreeCmd.AddCommand(holotreeExportCmd)
 	holotreeExportCmd.Flags().StringVarP(&specFile, "specification", "s", "", "Filename to use as export speficifaction in YAML format.")
+	holotreeExportCmd.Flags().BoolVarP(&standaloneFlag, "standalone", "", false, "Export space as standalone tar.gz archive, which can be used without rcc.")
 	holotreeExportCmd.Flags().StringVarP(&holozip, "zipfile", "z", "hololib.zip", "Name of zipfile to export.")
 	holotreeExportCmd.Flags().BoolVarP(&jsonFlag, "json", "j", false, "Output in JSON format")
-	holotreeExportCmd.Flags().StringVarP(&exportRobot, "robot", "r", "", "Full path to 'robot.yaml' configuration file to export as catalog. <optional>")
+	holotreeExportCmd.Flags().StringArrayVarP(&exportRobots, "robot", "r", []string{}, "Full path to 'robot.yaml' configuration file to export as catalog. Can be given multiple times. <optional>")
+	holotreeExportCmd.Flags().StringArrayVarP(&exportCondas, "conda", "c", []string{}, "Full path to 'conda.yaml' environment file to export as catalog. Can be given multiple times. <optional>")
 }
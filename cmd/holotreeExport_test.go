@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/robocorp/rcc/hamlet"
+)
+
+const (
+	exportRobotYaml = "tasks:\n  task:\n    shell: python task.py\ncondaConfigFile: conda.yaml\nartifactsDir: output\n"
+)
+
+func exportFixture(t *testing.T, directory, filename, content string) string {
+	fullpath := filepath.Join(directory, filename)
+	err := os.MkdirAll(filepath.Dir(fullpath), 0o755)
+	if err == nil {
+		err = os.WriteFile(fullpath, []byte(content), 0o644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fullpath
+}
+
+func TestExportUnionDeduplicatesCatalogsOfRobotsAndCondas(t *testing.T) {
+	must, _ := hamlet.Specifications(t)
+
+	base := t.TempDir()
+	shared := "channels:\n- conda-forge\ndependencies:\n- python=3.10.12\n"
+	other := "channels:\n- conda-forge\ndependencies:\n- python=3.11.4\n"
+	exportFixture(t, base, "first/conda.yaml", shared)
+	exportFixture(t, base, "second/conda.yaml", shared)
+	defer func(robots, condas []string) {
+		exportRobots, exportCondas = robots, condas
+	}(exportRobots, exportCondas)
+	exportRobots = []string{
+		exportFixture(t, base, "first/robot.yaml", exportRobotYaml),
+		exportFixture(t, base, "second/robot.yaml", exportRobotYaml),
+	}
+	exportCondas = []string{
+		exportFixture(t, base, "other.yaml", other),
+		filepath.Join(base, "first", "conda.yaml"),
+	}
+
+	condafiles := exportableCondafiles()
+	must.Equal(4, len(condafiles))
+	must.Equal(filepath.Join(base, "first", "conda.yaml"), condafiles[0])
+	catalogs := make([]string, 0, len(condafiles))
+	for _, condafile := range condafiles {
+		catalogs = append(catalogs, exportableCatalog(condafile))
+	}
+	must.Equal(catalogs[0], catalogs[1])
+	must.Equal(catalogs[0], catalogs[3])
+	must.Equal(2, len(unionCatalogs(catalogs)))
+	must.Equal(2, len(unionCatalogs(catalogs[:2], catalogs[2:])))
+}
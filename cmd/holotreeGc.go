@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/htfs"
+	"github.com/robocorp/rcc/pretty"
+	"github.com/spf13/cobra"
+)
+
+var holotreeGcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove hololib library objects not referenced by any catalog.",
+	Long: `Remove hololib library objects not referenced by any catalog.
+
+This is mark-and-sweep garbage collection. All catalogs are loaded and every
+digest they refer to is marked. Then every library object that was not marked
+is removed. Packs made by "rcc holotree repack" are rewritten without their
+unreferenced objects, or removed if nothing in them is referenced. Holotree
+lock is held during whole operation, so this is safe to run while other rcc
+processes are creating or restoring environments.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if common.DebugFlag {
+			defer common.Stopwatch("Holotree gc command lasted").Report()
+		}
+		stats, err := htfs.CollectGarbage(dryFlag)
+		pretty.Guard(err == nil, 1, "Garbage collection failed, reason: %v", err)
+		common.Log("Catalogs:          %d", stats.Catalogs)
+		common.Log("Library objects:   %d (%dM)", stats.Objects, megas(stats.Bytes))
+		common.Log("Unreferenced:      %d", stats.Garbage)
+		if dryFlag {
+			common.Log("Would reclaim:     %d bytes (%dM)", stats.Reclaimed, megas(stats.Reclaimed))
+		} else {
+			common.Log("Reclaimed:         %d bytes (%dM)", stats.Reclaimed, megas(stats.Reclaimed))
+		}
+		pretty.Ok()
+	},
+}
+
+func init() {
+	holotreeCmd.AddCommand(holotreeGcCmd)
+	holotreeGcCmd.Flags().BoolVarP(&dryFlag, "dry-run", "d", false, "Don't remove anything, just show what would be reclaimed.")
+}
@@ -5,9 +5,11 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"text/tabwriter"
 
 	"github.com/robocorp/rcc/cloud"
 	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/htfs"
 	"github.com/robocorp/rcc/operations"
 	"github.com/robocorp/rcc/pretty"
 	"github.com/spf13/cobra"
@@ -31,26 +33,91 @@ func temporaryDownload(at int, link string) (string, error) {
 	return zipfile, nil
 }
 
+var (
+	importPreview   bool
+	importDirectory string
+	importBlueprint string
+)
+
+func adoptDirectory(directory, condafile string) {
+	pretty.Guard(len(condafile) > 0, 6, "Option --from-dir requires --blueprint conda.yaml option.")
+	_, blueprint, err := htfs.ComposeFinalBlueprint([]string{condafile}, "")
+	pretty.Guard(err == nil, 6, "Could not compose blueprint from %q, reason: %v", condafile, err)
+	catalog, err := htfs.AdoptDirectory(directory, blueprint)
+	pretty.Guard(err == nil, 7, "Could not adopt %q, reason: %v", directory, err)
+	common.Log("Directory %q adopted as catalog %q.", directory, catalog)
+}
+
+func previewArchive(filename string) {
+	manifest, err := htfs.ArchiveManifest(filename)
+	pretty.Guard(err == nil, 4, "Could not read manifest from %q, reason: %v", filename, err)
+	if jsonFlag {
+		content, err := operations.NiceJsonOutput(manifest)
+		pretty.Guard(err == nil, 5, "%v", err)
+		common.Stdout("%s\n", content)
+	} else if manifest == nil {
+		common.Log("Archive %q has no manifest.", filename)
+	} else {
+		tabbed := tabwriter.NewWriter(os.Stderr, 2, 4, 2, ' ', 0)
+		tabbed.Write([]byte(fmt.Sprintf("Archive %q made by rcc %s at %s:\n\n", filename, manifest.RccVersion, manifest.Created)))
+		tabbed.Write([]byte("Catalog\tBlueprint\tPlatform\tRcc\tObjects\tSize\n"))
+		tabbed.Write([]byte("-------\t---------\t--------\t---\t-------\t----\n"))
+		for _, catalog := range manifest.Catalogs {
+			tabbed.Write([]byte(fmt.Sprintf("%s\t%s\t%s\t%s\t%d\t%dM\n", catalog.Name, catalog.Blueprint, catalog.Platform, catalog.RccVersion, catalog.Objects, megas(catalog.Size))))
+		}
+		tabbed.Flush()
+		common.Log("Archive has %d library objects, total %dM compressed.", manifest.Objects, megas(manifest.Size))
+	}
+	_, err = htfs.VerifyArchive(filename)
+	if err != nil {
+		pretty.Warning("Import would be rejected, reason: %v", err)
+	}
+}
+
 var holotreeImportCmd = &cobra.Command{
 	Use:   "import hololib.zip+",
 	Short: "Import one or more hololib.zip files into local hololib.",
-	Long:  "Import one or more hololib.zip files into local hololib.",
-	Args:  cobra.MinimumNArgs(1),
+	Long: `Import one or more hololib.zip files into local hololib.
+
+With --from-dir and --blueprint options, existing directory (for example hand
+built conda environment or venv) is adopted into hololib as catalog of given
+blueprint, without building anything. Spaces restored from adopted catalog are
+relocated from that directory.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		var err error
 
 		if common.DebugFlag {
 			defer common.Stopwatch("Holotree import command lasted").Report()
 		}
+		if len(importDirectory) > 0 {
+			pretty.Guard(len(args) == 0, 6, "Cannot import archives and adopt directory at the same time.")
+			adoptDirectory(importDirectory, importBlueprint)
+			pretty.Ok()
+			return
+		}
+		pretty.Guard(len(args) > 0, 6, "Give at least one hololib.zip to import, or use --from-dir option.")
+		verified := make([]string, 0, len(args))
 		for at, filename := range args {
 			if isUrl(filename) {
 				filename, err = temporaryDownload(at, filename)
 				pretty.Guard(err == nil, 2, "Could not download %q, reason: %v", filename, err)
 				defer os.Remove(filename)
 			}
+			if importPreview {
+				previewArchive(filename)
+				continue
+			}
+			_, err = htfs.VerifyArchive(filename)
+			pretty.Guard(err == nil, 3, "Could not import %q, reason: %v", filename, err)
+			err = htfs.VerifyZipCatalogs(filename)
+			pretty.Guard(err == nil, 3, "Could not import %q, reason: %v", filename, err)
+			verified = append(verified, filename)
+		}
+		for _, filename := range verified {
 			common.Timeline("Import %v", filename)
 			err = operations.Unzip(common.HololibLocation(), filename, true, false)
 			pretty.Guard(err == nil, 1, "Could not import %q, reason: %v", filename, err)
+			os.Remove(filepath.Join(common.HololibLocation(), htfs.ManifestName))
 		}
 		pretty.Ok()
 	},
@@ -58,4 +125,8 @@ var holotreeImportCmd = &cobra.Command{
 
 func init() {
 	holotreeCmd.AddCommand(holotreeImportCmd)
+	holotreeImportCmd.Flags().BoolVarP(&importPreview, "preview", "p", false, "Only show manifest of archives, and do not import anything.")
+	holotreeImportCmd.Flags().BoolVarP(&jsonFlag, "json", "j", false, "Output preview in JSON format.")
+	holotreeImportCmd.Flags().StringVarP(&importDirectory, "from-dir", "", "", "Adopt existing environment directory into hololib, instead of importing archives.")
+	holotreeImportCmd.Flags().StringVarP(&importBlueprint, "blueprint", "", "", "The conda.yaml file which describes adopted directory.")
 }
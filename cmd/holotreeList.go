@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"text/tabwriter"
+	"time"
 
 	"github.com/robocorp/rcc/common"
 	"github.com/robocorp/rcc/htfs"
@@ -13,12 +14,30 @@ import (
 	"github.com/spf13/cobra"
 )
 
+func lifecycleStamp(when time.Time) string {
+	if when.IsZero() {
+		return "-"
+	}
+	return when.Format("2006-01-02 15:04")
+}
+
 func humaneHolotreeSpaceListing() {
 	tabbed := tabwriter.NewWriter(os.Stderr, 2, 4, 2, ' ', 0)
-	tabbed.Write([]byte("Identity\tController\tSpace\tBlueprint\tFull path\n"))
-	tabbed.Write([]byte("--------\t----------\t-----\t--------\t---------\n"))
-	for _, space := range htfs.Spaces() {
-		data := fmt.Sprintf("%s\t%s\t%s\t%s\t%s\n", space.Identity, space.Controller, space.Space, space.Blueprint, space.Path)
+	tabbed.Write([]byte("Identity\tController\tSpace\tBlueprint\tFull path\tPool\tLease\tLast used\tLast run\n"))
+	tabbed.Write([]byte("--------\t----------\t-----\t--------\t---------\t----\t-----\t---------\t--------\n"))
+	spaces := htfs.Spaces()
+	pools := htfs.PoolUtilisation(spaces)
+	for _, space := range spaces {
+		pool := "-"
+		if usage, ok := pools[space.PoolKey()]; ok {
+			pool = usage.String()
+		}
+		lease := "-"
+		if found, active := htfs.LoadLease(space.Path); active {
+			lease = found.String()
+		}
+		life := htfs.SpaceLifecycle(space)
+		data := fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", space.Identity, space.Controller, space.Space, space.Blueprint, space.Path, pool, lease, lifecycleStamp(life.LastUsed), lifecycleStamp(life.LastRun))
 		tabbed.Write([]byte(data))
 	}
 	tabbed.Flush()
@@ -26,7 +45,9 @@ func humaneHolotreeSpaceListing() {
 
 func jsonicHolotreeSpaceListing() {
 	details := make(map[string]map[string]string)
-	for _, space := range htfs.Spaces() {
+	spaces := htfs.Spaces()
+	pools := htfs.PoolUtilisation(spaces)
+	for _, space := range spaces {
 		hold, ok := details[space.Identity]
 		if !ok {
 			hold = make(map[string]string)
@@ -39,6 +60,25 @@ func jsonicHolotreeSpaceListing() {
 			hold["meta"] = space.Path + ".meta"
 			hold["spec"] = filepath.Join(space.Path, "identity.yaml")
 			hold["plan"] = filepath.Join(space.Path, "rcc_plan.log")
+			if len(space.Adopted) > 0 {
+				hold["adopted"] = space.Adopted
+			}
+			life := htfs.SpaceLifecycle(space)
+			hold["last-used"] = life.LastUsed.Format(time.RFC3339)
+			hold["unused-days"] = fmt.Sprintf("%d", life.UnusedDays)
+			if !life.LastRun.IsZero() {
+				hold["last-run"] = life.LastRun.Format(time.RFC3339)
+			}
+			if usage, ok := pools[space.PoolKey()]; ok {
+				hold["pool"] = usage.Name
+				hold["pool-size"] = fmt.Sprintf("%d", usage.Size)
+				hold["pool-leased"] = fmt.Sprintf("%d", usage.Leased)
+			}
+			if found, active := htfs.LoadLease(space.Path); active {
+				hold["lease"] = found.String()
+				hold["lease-pid"] = fmt.Sprintf("%d", found.Pid)
+				hold["lease-heartbeat"] = found.Heartbeat.Format(time.RFC3339)
+			}
 		}
 	}
 	body, err := json.MarshalIndent(details, "", "  ")
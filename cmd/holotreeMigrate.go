@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/htfs"
+	"github.com/robocorp/rcc/pretty"
+	"github.com/spf13/cobra"
+)
+
+var holotreeMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Write binary copies of legacy JSON hololib catalogs.",
+	Long: `Write binary copies of legacy JSON hololib catalogs.
+
+Catalogs written by older rcc versions are in JSON format. They are migrated
+to binary format one by one, when their environments are first used, and this
+command migrates all of them at once (for example, before taking hololib
+offline or into use by many machines). Legacy catalogs are left in place for
+older rcc versions sharing same hololib, and signed legacy catalogs are
+skipped, since their signatures would not match. Holotree lock is held during
+whole operation.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if common.DebugFlag {
+			defer common.Stopwatch("Holotree migrate command lasted").Report()
+		}
+		migrated, skipped, err := htfs.MigrateCatalogs()
+		pretty.Guard(err == nil, 1, "Migrating catalogs failed, reason: %v", err)
+		common.Log("Migrated catalogs: %d", migrated)
+		common.Log("Skipped (signed):  %d", skipped)
+		pretty.Ok()
+	},
+}
+
+func init() {
+	holotreeCmd.AddCommand(holotreeMigrateCmd)
+}
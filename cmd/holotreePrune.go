@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/htfs"
+	"github.com/robocorp/rcc/operations"
+	"github.com/robocorp/rcc/pretty"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pruneUnusedDays int
+	pruneKeep       int
+)
+
+func humaneHolotreePrune(spaces htfs.Lifecycles) {
+	tabbed := tabwriter.NewWriter(os.Stderr, 2, 4, 2, ' ', 0)
+	tabbed.Write([]byte("Identity\tController\tSpace\tLast used\tLast run\tPruned\tReason\n"))
+	tabbed.Write([]byte("--------\t----------\t-----\t---------\t--------\t------\t------\n"))
+	for _, space := range spaces {
+		tabbed.Write([]byte(fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%v\t%s\n", space.Identity, space.Controller, space.Space, lifecycleStamp(space.LastUsed), lifecycleStamp(space.LastRun), space.Pruned, space.Reason)))
+	}
+	tabbed.Write([]byte("\n"))
+	tabbed.Flush()
+}
+
+var holotreePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove holotree spaces that have not been used for a while.",
+	Long: `Remove holotree spaces that have not been used for a while.
+
+Spaces that have not been used (restored or run) for given number of days are
+removed, but given number of most recently used spaces are always kept for each
+controller. Spaces that are leased or in use by running robots are never removed.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if common.DebugFlag {
+			defer common.Stopwatch("Holotree prune command lasted").Report()
+		}
+		pretty.Guard(pruneUnusedDays > 0, 1, "Option --unused-days must be positive, got %d.", pruneUnusedDays)
+		spaces, err := htfs.PruneSpaces(pruneUnusedDays, pruneKeep, dryFlag)
+		pretty.Guard(err == nil, 2, "Pruning spaces failed, reason: %v", err)
+		if jsonFlag {
+			content, err := operations.NiceJsonOutput(spaces)
+			pretty.Guard(err == nil, 3, "%v", err)
+			common.Stdout("%s\n", content)
+		} else {
+			humaneHolotreePrune(spaces)
+		}
+		if dryFlag {
+			common.Log("Would prune %d of %d spaces.", spaces.Pruned(), len(spaces))
+		} else {
+			common.Log("Pruned %d of %d spaces.", spaces.Pruned(), len(spaces))
+		}
+		pretty.Ok()
+	},
+}
+
+func init() {
+	holotreeCmd.AddCommand(holotreePruneCmd)
+	holotreePruneCmd.Flags().IntVarP(&pruneUnusedDays, "unused-days", "", 30, "Remove spaces that have not been used for this many days.")
+	holotreePruneCmd.Flags().IntVarP(&pruneKeep, "keep-per-controller", "", 1, "Always keep this many most recently used spaces per controller.")
+	holotreePruneCmd.Flags().BoolVarP(&dryFlag, "dry-run", "d", false, "Don't remove anything, just show what would be pruned.")
+	holotreePruneCmd.Flags().BoolVarP(&jsonFlag, "json", "j", false, "Output in JSON format.")
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/htfs"
+	"github.com/robocorp/rcc/pretty"
+	"github.com/spf13/cobra"
+)
+
+var holotreeRepackCmd = &cobra.Command{
+	Use:   "repack",
+	Short: "Move hololib library objects into single pack file with index.",
+	Long: `Move hololib library objects into single pack file with index.
+
+Every object referenced by any catalog is appended into new pack file, which
+has sorted index next to it (like git packfiles). After that, loose library
+objects and old pack files are removed. This cuts inode count of hololib
+significantly. Objects not referenced by any catalog are dropped from packs,
+but loose unreferenced objects are left for "rcc holotree gc" to remove.
+
+All reads from hololib find objects from packs transparently, and new objects
+are still stored as loose files, so rerun this command from time to time.
+Holotree lock is held during whole operation.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if common.DebugFlag {
+			defer common.Stopwatch("Holotree repack command lasted").Report()
+		}
+		stats, err := htfs.Repack()
+		pretty.Guard(err == nil, 1, "Repacking hololib failed, reason: %v", err)
+		common.Log("Catalogs:          %d", stats.Catalogs)
+		common.Log("Loose objects:     %d", stats.Loose)
+		common.Log("Repacked objects:  %d", stats.Repacked)
+		common.Log("Dropped objects:   %d", stats.Dropped)
+		common.Log("Packed total:      %d (%dM)", stats.Objects, megas(stats.Bytes))
+		if len(stats.Packfile) > 0 {
+			common.Log("Pack file:         %s", stats.Packfile)
+		}
+		pretty.Ok()
+	},
+}
+
+func init() {
+	holotreeCmd.AddCommand(holotreeRepackCmd)
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/htfs"
+	"github.com/robocorp/rcc/operations"
+	"github.com/robocorp/rcc/pretty"
+	"github.com/spf13/cobra"
+)
+
+func humaneHolotreeReproduce(report *htfs.Reproduction) {
+	tabbed := tabwriter.NewWriter(os.Stderr, 2, 4, 2, ' ', 0)
+	tabbed.Write([]byte(fmt.Sprintf("Blueprint: %s\n", report.Blueprint)))
+	if len(report.Files) > 0 {
+		tabbed.Write([]byte("\nStatus\tClass\tPath\tFirst\tSecond\n"))
+		tabbed.Write([]byte("------\t-----\t----\t-----\t------\n"))
+		for _, entry := range report.Files {
+			before, after := "-", "-"
+			if entry.Before != nil {
+				before = entry.Before.String()
+			}
+			if entry.After != nil {
+				after = entry.After.String()
+			}
+			tabbed.Write([]byte(fmt.Sprintf("%s\t%s\t%s\t%s\t%s\n", diffMarker(entry.Status), entry.Class, entry.Path, before, after)))
+		}
+	}
+	if len(report.Packages) > 0 {
+		tabbed.Write([]byte("\nPackage\tChannel\tFirst\tSecond\n"))
+		tabbed.Write([]byte("-------\t-------\t-----\t------\n"))
+		for _, change := range report.Packages {
+			tabbed.Write([]byte(fmt.Sprintf("%s\t%s\t%s\t%s\n", change.Name, change.Origin, change.Before, change.After)))
+		}
+	}
+	tabbed.Write([]byte("\n"))
+	tabbed.Flush()
+	files := report.Files
+	common.Log("Files: %d pyc, %d RECORD, %d timestamp, and %d content differences.", files.Count(htfs.ReproducePyc), files.Count(htfs.ReproduceRecord), files.Count(htfs.ReproduceTimestamp), files.Count(htfs.ReproduceContent))
+	common.Log("Packages: %d differences.", len(report.Packages))
+}
+
+var holotreeReproduceCmd = &cobra.Command{
+	Use:   "reproduce <conda.yaml>",
+	Short: "Build environment twice and report differences between those builds.",
+	Long: `Build environment twice and report differences between those builds.
+
+Blueprint from given conda.yaml is built twice into virtual holotree libraries,
+and resulting file trees are compared. Each difference is classified as pyc,
+record (pip RECORD files), timestamp, or content difference. Built environments
+are not recorded into hololib.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if common.DebugFlag {
+			defer common.Stopwatch("Holotree reproduce command lasted").Report()
+		}
+		report, err := htfs.Reproduce(args[0])
+		pretty.Guard(err == nil, 1, "%v", err)
+		if jsonFlag {
+			content, err := operations.NiceJsonOutput(report)
+			pretty.Guard(err == nil, 2, "%v", err)
+			common.Stdout("%s\n", content)
+		} else {
+			humaneHolotreeReproduce(report)
+		}
+		pretty.Guard(report.Reproducible(), 3, "Blueprint %q build is not reproducible.", report.Blueprint)
+		pretty.Ok()
+	},
+}
+
+func init() {
+	holotreeCmd.AddCommand(holotreeReproduceCmd)
+	holotreeReproduceCmd.Flags().BoolVarP(&jsonFlag, "json", "j", false, "Output in JSON format.")
+}
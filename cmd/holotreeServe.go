@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"net/http"
+
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/htfs"
+	"github.com/robocorp/rcc/pretty"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveAddress string
+)
+
+var holotreeServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve local hololib as static files for remote read-through use.",
+	Long: `Serve local hololib as static files for remote read-through use.
+
+Only catalog and library directories are served, using same layout as they
+have in local hololib. Other rcc instances can then use this as their remote
+hololib by setting "holotree: remote-hololib:" in their settings.yaml.
+Objects that were moved into pack files are served as loose library files.
+Directory listings are not served.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		common.Log("Serving hololib %q at http://%s/", common.HololibLocation(), serveAddress)
+		err := http.ListenAndServe(serveAddress, htfs.HololibHandler())
+		pretty.Guard(err == nil, 1, "Serving hololib failed, reason: %v", err)
+	},
+}
+
+func init() {
+	holotreeCmd.AddCommand(holotreeServeCmd)
+	holotreeServeCmd.Flags().StringVarP(&serveAddress, "listen", "l", "localhost:8080", "Address where to listen for HTTP requests.")
+}
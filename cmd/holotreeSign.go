@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/htfs"
+	"github.com/robocorp/rcc/pretty"
+	"github.com/spf13/cobra"
+)
+
+var (
+	signGenerate bool
+	signPublic   bool
+	signAll      bool
+)
+
+func signableCatalogs(names []string) []string {
+	catalogs := htfs.Catalogs()
+	if signAll {
+		return catalogs
+	}
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		found := false
+		for _, catalog := range catalogs {
+			if catalog == name || strings.HasPrefix(catalog, strings.TrimSuffix(htfs.CatalogName(name), common.Platform())) {
+				result = append(result, catalog)
+				found = true
+			}
+		}
+		pretty.Guard(found, 3, "Could not find catalog for %q.", name)
+	}
+	return result
+}
+
+var holotreeSignCmd = &cobra.Command{
+	Use:   "sign <catalog>*",
+	Short: "Sign hololib catalogs using local ed25519 signing key.",
+	Long: `Sign hololib catalogs using local ed25519 signing key.
+
+Signatures are stored in hololib "signatures" directory, and they are included
+in hololib.zip exports. Public key of signer must be listed in settings.yaml
+"holotree: trusted-keys:" for signatures to be accepted, and policy in
+"holotree: signature-policy:" decides if verification is "off", only "warn"s,
+or "enforce"s valid signatures on import and restore.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if common.DebugFlag {
+			defer common.Stopwatch("Holotree sign command lasted").Report()
+		}
+		if signGenerate {
+			public, err := htfs.GenerateSigningKey()
+			pretty.Guard(err == nil, 1, "%v", err)
+			common.Log("Signing key saved to %q.", htfs.SigningKeyLocation())
+			common.Stdout("%s\n", public)
+		}
+		if signPublic {
+			public, err := htfs.SigningPublicKey()
+			pretty.Guard(err == nil, 2, "%v", err)
+			common.Stdout("%s\n", public)
+		}
+		for _, catalog := range signableCatalogs(args) {
+			err := htfs.SignCatalog(filepath.Join(common.HololibCatalogLocation(), catalog))
+			pretty.Guard(err == nil, 4, "Could not sign %q, reason: %v", catalog, err)
+			common.Log("Signed %s", catalog)
+		}
+		pretty.Ok()
+	},
+}
+
+func init() {
+	holotreeCmd.AddCommand(holotreeSignCmd)
+	holotreeSignCmd.Flags().BoolVarP(&signGenerate, "generate", "g", false, "Generate new local signing key, and show its public key.")
+	holotreeSignCmd.Flags().BoolVarP(&signPublic, "public", "p", false, "Show public key of local signing key.")
+	holotreeSignCmd.Flags().BoolVarP(&signAll, "all", "a", false, "Sign all catalogs in hololib.")
+}
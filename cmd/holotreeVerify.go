@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/htfs"
+	"github.com/robocorp/rcc/operations"
+	"github.com/robocorp/rcc/pretty"
+	"github.com/spf13/cobra"
+)
+
+var (
+	verifyHeal bool
+)
+
+func driftMarker(status string) string {
+	switch status {
+	case htfs.DriftAdded:
+		return fmt.Sprintf("%s+%s", pretty.Green, pretty.Reset)
+	case htfs.DriftMissing:
+		return fmt.Sprintf("%s-%s", pretty.Red, pretty.Reset)
+	default:
+		return fmt.Sprintf("%s~%s", pretty.Yellow, pretty.Reset)
+	}
+}
+
+func humaneHolotreeVerify(report *htfs.SpaceDrift) {
+	tabbed := tabwriter.NewWriter(os.Stderr, 2, 4, 2, ' ', 0)
+	tabbed.Write([]byte(fmt.Sprintf("Space: %s [%s %s] %s\n", report.Identity, report.Space, report.Blueprint, report.Path)))
+	if len(report.Drifts) > 0 {
+		tabbed.Write([]byte("\nStatus\tReason\tPath\n"))
+		tabbed.Write([]byte("------\t------\t----\n"))
+		for _, entry := range report.Drifts {
+			tabbed.Write([]byte(fmt.Sprintf("%s\t%s\t%s\n", driftMarker(entry.Status), entry.Reason, entry.Path)))
+		}
+	}
+	tabbed.Write([]byte("\n"))
+	tabbed.Flush()
+	drifts := report.Drifts
+	common.Log("Checked %d entries: %d modified, %d added, %d missing.", report.Checked, drifts.Count(htfs.DriftModified), drifts.Count(htfs.DriftAdded), drifts.Count(htfs.DriftMissing))
+	if report.Healed {
+		common.Log("Healed %d drifted entries from hololib.", len(drifts))
+	}
+}
+
+var holotreeVerifyCmd = &cobra.Command{
+	Use:   "verify <space>",
+	Short: "Verify holotree space files against its metadata, without restoring it.",
+	Long: `Verify holotree space files against its metadata, without restoring it.
+
+Argument can be space identity or space name. Result lists modified, added,
+and missing files compared to space .meta file. With --heal option, drifted
+files are restored from hololib (and extra files are removed).`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if common.DebugFlag {
+			defer common.Stopwatch("Holotree verify command lasted").Report()
+		}
+		spaces := htfs.FindSpaces(args[0])
+		pretty.Guard(len(spaces) > 0, 1, "Name %q does not match any space.", args[0])
+		pretty.Guard(len(spaces) == 1, 1, "Name %q matches multiple spaces: %s", args[0], strings.Join(spaces, ", "))
+		tree, err := htfs.New()
+		pretty.Guard(err == nil, 2, "%v", err)
+		report, err := htfs.VerifySpace(tree, spaces[0])
+		pretty.Guard(err == nil, 3, "%v", err)
+		if verifyHeal && len(report.Drifts) > 0 {
+			err = report.Heal(tree)
+			pretty.Guard(err == nil, 4, "%v", err)
+		}
+		if jsonFlag {
+			content, err := operations.NiceJsonOutput(report)
+			pretty.Guard(err == nil, 5, "%v", err)
+			common.Stdout("%s\n", content)
+		} else {
+			humaneHolotreeVerify(report)
+		}
+		pretty.Guard(report.Healed || len(report.Drifts) == 0, 6, "Space %q has drifted from its metadata.", report.Identity)
+		pretty.Ok()
+	},
+}
+
+func init() {
+	holotreeCmd.AddCommand(holotreeVerifyCmd)
+	holotreeVerifyCmd.Flags().BoolVarP(&jsonFlag, "json", "j", false, "Output in JSON format.")
+	holotreeVerifyCmd.Flags().BoolVarP(&verifyHeal, "heal", "", false, "Restore drifted files from hololib.")
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/robocorp/rcc/cloud"
 	"github.com/robocorp/rcc/cmd"
 	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/htfs"
 	"github.com/robocorp/rcc/operations"
 	"github.com/robocorp/rcc/pathlib"
 )
@@ -102,6 +103,7 @@ func main() {
 	defer common.EndOfTimeline()
 	go startTempRecycling()
 	defer markTempForRecycling()
+	defer htfs.ReleaseLease()
 	defer os.Stderr.Sync()
 	defer os.Stdout.Sync()
 	cmd.Execute()
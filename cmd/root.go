@@ -106,6 +106,10 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $ROBOCORP_HOME/rcc.yaml)")
 
 	rootCmd.PersistentFlags().BoolVarP(&common.NoBuild, "no-build", "", false, "never allow building new environments, only use what exists already in hololib")
+	rootCmd.PersistentFlags().BoolVarP(&common.SwapRestore, "swap-restore", "", false, "restore holotree spaces into sibling directory and swap them in atomically")
+	rootCmd.PersistentFlags().BoolVarP(&common.ProtectSpaces, "protect-spaces", "", false, "make restored holotree space files and directories read-only, so robot runs cannot modify them")
+	rootCmd.PersistentFlags().StringVarP(&common.LeasePolicy, "lease-policy", "", "wait", "when space is leased by another running robot: wait, fail, or fallback (to '<space>-fallback' space)")
+	rootCmd.PersistentFlags().IntVarP(&common.SpacePool, "space-pool", "", 0, "use first free space from pool of '<space>-1' up to '<space>-N' spaces (for parallel runs of same robot)")
 	rootCmd.PersistentFlags().BoolVarP(&common.Silent, "silent", "", false, "be less verbose on output")
 	rootCmd.PersistentFlags().BoolVarP(&common.Liveonly, "liveonly", "", false, "do not create base environment from live ... DANGER! For containers only!")
 	rootCmd.PersistentFlags().BoolVarP(&pathlib.Lockless, "lockless", "", false, "do not use file locking ... DANGER!")
@@ -18,6 +18,9 @@ const (
 
 var (
 	NoBuild            bool
+	SwapRestore        bool
+	ProtectSpaces      bool
+	SpacePool          int
 	Silent             bool
 	DebugFlag          bool
 	TraceFlag          bool
@@ -32,6 +35,9 @@ var (
 	StageFolder        string
 	ControllerType     string
 	HolotreeSpace      string
+	HolotreeTarget     string
+	LeasePolicy        string
+	HolotreePool       string
 	EnvironmentHash    string
 	SemanticTag        string
 	ForcedRobocorpHome string
@@ -182,6 +188,18 @@ func HololibLibraryLocation() string {
 	return filepath.Join(HololibLocation(), "library")
 }
 
+func HololibLinksLocation() string {
+	return filepath.Join(HololibLocation(), "links")
+}
+
+func HololibPackLocation() string {
+	return filepath.Join(HololibLocation(), "packs")
+}
+
+func HololibSignatureLocation() string {
+	return filepath.Join(HololibLocation(), "signatures")
+}
+
 func HololibUsageLocation() string {
 	return filepath.Join(HololibLocation(), "used")
 }
@@ -190,6 +208,14 @@ func HolotreeLock() string {
 	return filepath.Join(HolotreeLocation(), "global.lck")
 }
 
+func HolotreeStageLock() string {
+	return filepath.Join(HolotreeLocation(), "stage.lck")
+}
+
+func HolotreeBlueprintLock(blueprint string) string {
+	return filepath.Join(HololibLocation(), "locks", fmt.Sprintf("%s.lck", blueprint))
+}
+
 func UsesHolotree() bool {
 	return len(HolotreeSpace) > 0
 }
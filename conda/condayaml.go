@@ -22,6 +22,7 @@ type internalEnvironment struct {
 	Dependencies []interface{} `yaml:"dependencies"`
 	Prefix       string        `yaml:"prefix,omitempty"`
 	PostInstall  []string      `yaml:"rccPostInstall,omitempty"`
+	Precompile   string        `yaml:"rccPrecompile,omitempty"`
 }
 
 type Environment struct {
@@ -31,6 +32,7 @@ type Environment struct {
 	Conda       []*Dependency
 	Pip         []*Dependency
 	PostInstall []string
+	Precompile  string
 }
 
 type Dependency struct {
@@ -101,6 +103,7 @@ func (it *internalEnvironment) AsEnvironment() *Environment {
 		Name:        it.Name,
 		Prefix:      it.Prefix,
 		PostInstall: []string{},
+		Precompile:  it.Precompile,
 	}
 	seenScripts := make(map[string]bool)
 	result.PostInstall = addItem(seenScripts, it.PostInstall, result.PostInstall)
@@ -142,6 +145,7 @@ func (it *Environment) FreezeDependencies(fixed dependencies) *Environment {
 		Conda:       []*Dependency{},
 		Pip:         []*Dependency{},
 		PostInstall: it.PostInstall,
+		Precompile:  it.Precompile,
 	}
 	used := make(map[string]bool)
 	for _, dependency := range fixed {
@@ -185,6 +189,7 @@ func (it *Environment) FromDependencies(fixed dependencies) (*Environment, bool)
 		Conda:       []*Dependency{},
 		Pip:         []*Dependency{},
 		PostInstall: it.PostInstall,
+		Precompile:  it.Precompile,
 	}
 	same := true
 	for _, dependency := range it.Conda {
@@ -326,6 +331,11 @@ func (it *Environment) Merge(right *Environment) (*Environment, error) {
 	result.PostInstall = addItem(seenScripts, it.PostInstall, result.PostInstall)
 	result.PostInstall = addItem(seenScripts, right.PostInstall, result.PostInstall)
 
+	result.Precompile = it.Precompile
+	if len(right.Precompile) > 0 {
+		result.Precompile = right.Precompile
+	}
+
 	err := pushConda(result, it.Conda)
 	if err != nil {
 		return nil, err
@@ -446,6 +456,7 @@ func (it *Environment) AsYaml() (string, error) {
 	result.Dependencies = it.CondaList()
 	seenScripts := make(map[string]bool)
 	result.PostInstall = addItem(seenScripts, it.PostInstall, result.PostInstall)
+	result.Precompile = it.Precompile
 	if len(it.Pip) > 0 {
 		result.Dependencies = append(result.Dependencies, it.PipMap())
 	}
@@ -1,6 +1,7 @@
 package conda_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/robocorp/rcc/conda"
@@ -117,3 +118,49 @@ func TestCanCreateEmptyEnvironment(t *testing.T) {
 	sut := conda.SummonEnvironment("tmp/missing.yaml")
 	wont_be.Nil(sut)
 }
+
+func TestLayerBlueprintIgnoresPipDependencies(t *testing.T) {
+	must_be, wont_be := hamlet.Specifications(t)
+
+	sut, err := conda.ReadCondaYaml("testdata/conda.yaml")
+	must_be.Nil(err)
+	layer, err := conda.LayerBlueprint(sut)
+	must_be.Nil(err)
+	must_be.True(strings.HasPrefix(string(layer), "# rcc conda layer"))
+	wont_be.True(strings.Contains(string(layer), "webdrivermanager"))
+
+	sut.Pip = sut.Pip[:0]
+	same, err := conda.LayerBlueprint(sut)
+	must_be.Nil(err)
+	must_be.Equal(string(layer), string(same))
+
+	other, err := conda.ReadCondaYaml("testdata/third.yaml")
+	must_be.Nil(err)
+	different, err := conda.LayerBlueprint(other)
+	must_be.Nil(err)
+	wont_be.Equal(string(layer), string(different))
+}
+
+func TestCanMergePrecompilePolicy(t *testing.T) {
+	must_be, wont_be := hamlet.Specifications(t)
+
+	left, err := conda.CondaYamlFrom([]byte("rccPrecompile: unchecked-hash\n"))
+	must_be.Nil(err)
+	right, err := conda.CondaYamlFrom([]byte("dependencies:\n- python=3.10.12\n"))
+	must_be.Nil(err)
+
+	sut, err := left.Merge(right)
+	must_be.Nil(err)
+	must_be.Equal(conda.PrecompileUnchecked, sut.PrecompilePolicy())
+
+	right.Precompile = "None"
+	sut, err = left.Merge(right)
+	must_be.Nil(err)
+	must_be.Equal(conda.PrecompileNone, sut.PrecompilePolicy())
+
+	content, err := left.AsYaml()
+	must_be.Nil(err)
+	wont_be.Equal(-1, strings.Index(content, "rccPrecompile: unchecked-hash"))
+	must_be.Equal(conda.PrecompileUnchecked, conda.PrecompilePolicy([]byte(content)))
+	must_be.Equal(conda.PrecompileChecked, conda.PrecompilePolicy([]byte("rccPrecompile: checked-hash\n")))
+}
@@ -133,14 +133,62 @@ func LoadWantedDependencies(filename string) dependencies {
 	if err != nil {
 		return dependencies{}
 	}
+	return ParseWantedDependencies(body)
+}
+
+func ParseWantedDependencies(body []byte) dependencies {
 	result := make(dependencies, 0, 100)
-	err = yaml.Unmarshal(body, &result)
+	err := yaml.Unmarshal(body, &result)
 	if err != nil {
 		return dependencies{}
 	}
 	return result.sorted()
 }
 
+type DependencyChange struct {
+	Name   string `yaml:"name"   json:"name"`
+	Origin string `yaml:"origin" json:"channel"`
+	Before string `yaml:"before" json:"before"`
+	After  string `yaml:"after"  json:"after"`
+}
+
+func (it *DependencyChange) Added() bool {
+	return len(it.Before) == 0
+}
+
+func (it *DependencyChange) Removed() bool {
+	return len(it.After) == 0
+}
+
+func DependencyChanges(before, after dependencies) []*DependencyChange {
+	diffmap := make(map[string][2]int)
+	injectDiffmap(diffmap, before, 0)
+	injectDiffmap(diffmap, after, 1)
+	keyset := make([]string, 0, len(diffmap))
+	for key, _ := range diffmap {
+		keyset = append(keyset, key)
+	}
+	sort.Strings(keyset)
+	result := make([]*DependencyChange, 0, len(keyset))
+	for _, key := range keyset {
+		sides := diffmap[key]
+		change := &DependencyChange{}
+		if sides[0] > -1 {
+			entry := before[sides[0]]
+			change.Name, change.Origin, change.Before = entry.Name, entry.Origin, entry.Version
+		}
+		if sides[1] > -1 {
+			entry := after[sides[1]]
+			change.Name, change.Origin, change.After = entry.Name, entry.Origin, entry.Version
+		}
+		if change.Before == change.After {
+			continue
+		}
+		result = append(result, change)
+	}
+	return result
+}
+
 func SideBySideViewOfDependencies(goldenfile, wantedfile string) (err error) {
 	defer fail.Around(&err)
 
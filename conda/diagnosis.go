@@ -25,6 +25,24 @@ func MakeRelativeMap(root string, entries map[string]string) map[string]string {
 	return result
 }
 
+func DirtyFolders(history, future map[string]string) []string {
+	result := []string{}
+	for key, value := range history {
+		next, ok := future[key]
+		if !ok || value != next {
+			result = append(result, key)
+		}
+	}
+	for key, _ := range future {
+		_, ok := history[key]
+		if !ok {
+			result = append(result, key)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
 func DirhashDiff(history, future map[string]string, warning bool) {
 	removed := []string{}
 	added := []string{}
@@ -0,0 +1,64 @@
+package conda
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/journal"
+	"github.com/robocorp/rcc/pretty"
+	"github.com/robocorp/rcc/settings"
+)
+
+const (
+	layerHeader = "# rcc conda layer (micromamba phase only)\n"
+)
+
+type Layers interface {
+	HasLayer(blueprint []byte) bool
+	RestoreLayer(blueprint []byte, targetFolder string) (string, error)
+	RecordLayer(blueprint []byte, targetFolder string) error
+}
+
+func LayerBlueprint(environment *Environment) ([]byte, error) {
+	yaml, err := environment.AsPureConda().AsYaml()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(layerHeader + yaml), nil
+}
+
+func layersActive(layers Layers) bool {
+	return layers != nil && !settings.Global.NoCondaLayers()
+}
+
+func restoreLayer(layers Layers, layer []byte, targetFolder string, force bool, planWriter io.Writer) bool {
+	if force || !layersActive(layers) || !layers.HasLayer(layer) {
+		return false
+	}
+	common.Progress(5, "Restoring conda layer from hololib, skipping micromamba phase.")
+	key, err := layers.RestoreLayer(layer, targetFolder)
+	if err != nil {
+		pretty.Warning("Conda layer restore failed, running micromamba instead, reason: %v", err)
+		renameRemove(targetFolder)
+		return false
+	}
+	fmt.Fprintf(planWriter, "Conda layer %q restored from hololib @%s, micromamba phase skipped.\n", key, time.Now().Format(time.RFC3339))
+	journal.CurrentBuildEvent().LayerRestored(key)
+	common.Timeline("conda layer restored.")
+	return true
+}
+
+func recordLayer(layers Layers, layer []byte, targetFolder string) {
+	if !layersActive(layers) || layers.HasLayer(layer) {
+		return
+	}
+	common.Debug("===  conda layer record phase ===")
+	err := layers.RecordLayer(layer, targetFolder)
+	if err != nil {
+		pretty.Warning("Conda layer recording failed, reason: %v", err)
+		return
+	}
+	common.Timeline("conda layer recorded.")
+}
@@ -54,6 +54,7 @@ func NewPlanAnalyzer(realtime bool) *PlanAnalyzer {
 	strategies := make(StrategyMap)
 	strategies["micromamba"] = ignoreStrategy
 	strategies["post install"] = ignoreStrategy
+	strategies["precompile"] = ignoreStrategy
 	strategies["activation"] = ignoreStrategy
 	strategies["pip check"] = ignoreStrategy
 	strategies["pip"] = pipStrategy
@@ -0,0 +1,60 @@
+package conda
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/pretty"
+	"github.com/robocorp/rcc/settings"
+)
+
+const (
+	PrecompileNone      = "none"
+	PrecompileUnchecked = "unchecked-hash"
+	PrecompileChecked   = "checked-hash"
+)
+
+func (it *Environment) PrecompilePolicy() string {
+	policy := strings.ToLower(strings.TrimSpace(it.Precompile))
+	switch policy {
+	case PrecompileNone, PrecompileUnchecked, PrecompileChecked:
+		return policy
+	case "":
+		if settings.Global.PrecompileBytecode() {
+			return PrecompileUnchecked
+		}
+		return PrecompileNone
+	default:
+		common.Log("%sUnknown rccPrecompile policy %q, using %q instead.%s", pretty.Yellow, it.Precompile, PrecompileNone, pretty.Reset)
+		return PrecompileNone
+	}
+}
+
+// PrecompilePolicy tells what bytecode policy environment build used for
+// given blueprint, so that recording can keep matching bytecode files.
+func PrecompilePolicy(blueprint []byte) string {
+	environment, err := CondaYamlFrom(blueprint)
+	if err != nil {
+		return PrecompileNone
+	}
+	return environment.PrecompilePolicy()
+}
+
+func precompileBytecode(sink io.Writer, targetFolder, python, policy string) {
+	if policy == PrecompileNone {
+		fmt.Fprintf(sink, "Bytecode precompilation skipped -- policy is %q.\n", policy)
+		return
+	}
+	common.Debug("===  precompile phase ===")
+	common.Timeline("precompile start [%s].", policy)
+	defer common.Timeline("precompile done.")
+	// hash based pyc files do not depend on source mtime, so restored and
+	// relocated spaces can use them as they are
+	command := common.NewCommander(python, "-I", "-m", "compileall", "-q", "-f", "-j", "0", "--invalidation-mode", policy, targetFolder)
+	code, err := LiveExecution(sink, targetFolder, command.CLI()...)
+	if err != nil || code != 0 {
+		common.Log("%sBytecode precompilation was not fully successful [%d/%x], reason: %v%s", pretty.Yellow, code, code, err, pretty.Reset)
+	}
+}
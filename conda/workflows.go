@@ -88,7 +88,7 @@ func (it InstallObserver) HasFailures(targetFolder string) bool {
 	return false
 }
 
-func newLive(yaml, condaYaml, requirementsText, key string, force, freshInstall bool, postInstall []string) (bool, error) {
+func newLive(yaml, condaYaml, requirementsText, key string, force, freshInstall bool, postInstall []string, precompile string, layers Layers, layer []byte) (bool, error) {
 	if !MustMicromamba() {
 		return false, fmt.Errorf("Could not get micromamba installed.")
 	}
@@ -101,7 +101,7 @@ func newLive(yaml, condaYaml, requirementsText, key string, force, freshInstall
 	}
 	common.Debug("===  first try phase ===")
 	common.Timeline("first try.")
-	success, fatal := newLiveInternal(yaml, condaYaml, requirementsText, key, force, freshInstall, postInstall)
+	success, fatal := newLiveInternal(yaml, condaYaml, requirementsText, key, force, freshInstall, postInstall, precompile, layers, layer)
 	if !success && !force && !fatal {
 		journal.CurrentBuildEvent().Rebuild()
 		cloud.BackgroundMetric(common.ControllerIdentity(), "rcc.env.creation.retry", common.Version)
@@ -113,7 +113,7 @@ func newLive(yaml, condaYaml, requirementsText, key string, force, freshInstall
 		if err != nil {
 			return false, err
 		}
-		success, _ = newLiveInternal(yaml, condaYaml, requirementsText, key, true, freshInstall, postInstall)
+		success, _ = newLiveInternal(yaml, condaYaml, requirementsText, key, true, freshInstall, postInstall, precompile, layers, layer)
 	}
 	if success {
 		journal.CurrentBuildEvent().Successful()
@@ -121,7 +121,7 @@ func newLive(yaml, condaYaml, requirementsText, key string, force, freshInstall
 	return success, nil
 }
 
-func newLiveInternal(yaml, condaYaml, requirementsText, key string, force, freshInstall bool, postInstall []string) (bool, bool) {
+func newLiveInternal(yaml, condaYaml, requirementsText, key string, force, freshInstall bool, postInstall []string, precompile string, layers Layers, layer []byte) (bool, bool) {
 	targetFolder := common.StageFolder
 	planfile := fmt.Sprintf("%s.plan", targetFolder)
 	planSink, err := os.OpenFile(planfile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
@@ -147,31 +147,34 @@ func newLiveInternal(yaml, condaYaml, requirementsText, key string, force, fresh
 	fmt.Fprintf(planWriter, "%s\n", yaml)
 
 	common.Debug("Setting up new conda environment using %v to folder %v", condaYaml, targetFolder)
-	ttl := "57600"
+	ttl, code := "57600", 0
 	if force {
 		ttl = "0"
 	}
-	common.Progress(5, "Running micromamba phase. (micromamba v%s)", MicromambaVersion())
-	mambaCommand := common.NewCommander(BinMicromamba(), "create", "--always-copy", "--no-env", "--safety-checks", "enabled", "--extra-safety-checks", "--retry-clean-cache", "--strict-channel-priority", "--repodata-ttl", ttl, "-y", "-f", condaYaml, "-p", targetFolder)
-	mambaCommand.Option("--channel-alias", settings.Global.CondaURL())
-	mambaCommand.ConditionalFlag(common.VerboseEnvironmentBuilding(), "--verbose")
-	mambaCommand.ConditionalFlag(!settings.Global.HasMicroMambaRc(), "--no-rc")
-	mambaCommand.ConditionalFlag(settings.Global.HasMicroMambaRc(), "--rc-file", common.MicroMambaRcFile())
-	observer := make(InstallObserver)
-	common.Debug("===  micromamba create phase ===")
 	fmt.Fprintf(planWriter, "\n---  micromamba plan @%ss  ---\n\n", stopwatch)
-	tee := io.MultiWriter(observer, planWriter)
-	code, err := shell.New(CondaEnvironment(), ".", mambaCommand.CLI()...).Tracked(tee, false)
-	if err != nil || code != 0 {
-		cloud.BackgroundMetric(common.ControllerIdentity(), "rcc.env.fatal.micromamba", fmt.Sprintf("%d_%x", code, code))
-		common.Timeline("micromamba fail.")
-		common.Fatal(fmt.Sprintf("Micromamba [%d/%x]", code, code), err)
-		return false, false
-	}
-	journal.CurrentBuildEvent().MicromambaComplete()
-	common.Timeline("micromamba done.")
-	if observer.HasFailures(targetFolder) {
-		return false, true
+	if !restoreLayer(layers, layer, targetFolder, force, planWriter) {
+		common.Progress(5, "Running micromamba phase. (micromamba v%s)", MicromambaVersion())
+		mambaCommand := common.NewCommander(BinMicromamba(), "create", "--always-copy", "--no-env", "--safety-checks", "enabled", "--extra-safety-checks", "--retry-clean-cache", "--strict-channel-priority", "--repodata-ttl", ttl, "-y", "-f", condaYaml, "-p", targetFolder)
+		mambaCommand.Option("--channel-alias", settings.Global.CondaURL())
+		mambaCommand.ConditionalFlag(common.VerboseEnvironmentBuilding(), "--verbose")
+		mambaCommand.ConditionalFlag(!settings.Global.HasMicroMambaRc(), "--no-rc")
+		mambaCommand.ConditionalFlag(settings.Global.HasMicroMambaRc(), "--rc-file", common.MicroMambaRcFile())
+		observer := make(InstallObserver)
+		common.Debug("===  micromamba create phase ===")
+		tee := io.MultiWriter(observer, planWriter)
+		code, err = shell.New(CondaEnvironment(), ".", mambaCommand.CLI()...).Tracked(tee, false)
+		if err != nil || code != 0 {
+			cloud.BackgroundMetric(common.ControllerIdentity(), "rcc.env.fatal.micromamba", fmt.Sprintf("%d_%x", code, code))
+			common.Timeline("micromamba fail.")
+			common.Fatal(fmt.Sprintf("Micromamba [%d/%x]", code, code), err)
+			return false, false
+		}
+		journal.CurrentBuildEvent().MicromambaComplete()
+		common.Timeline("micromamba done.")
+		if observer.HasFailures(targetFolder) {
+			return false, true
+		}
+		recordLayer(layers, layer, targetFolder)
 	}
 	fmt.Fprintf(planWriter, "\n---  pip plan @%ss  ---\n\n", stopwatch)
 	python, pyok := FindPython(targetFolder)
@@ -232,6 +235,11 @@ func newLiveInternal(yaml, condaYaml, requirementsText, key string, force, fresh
 	} else {
 		common.Progress(7, "Post install scripts phase skipped -- no scripts.")
 	}
+	fmt.Fprintf(planWriter, "\n---  precompile plan @%ss  ---\n\n", stopwatch)
+	if pyok {
+		precompileBytecode(planWriter, targetFolder, python, precompile)
+		planSink.Sync()
+	}
 	common.Progress(8, "Activate environment started phase.")
 	common.Debug("===  activate phase ===")
 	fmt.Fprintf(planWriter, "\n---  activation plan @%ss  ---\n\n", stopwatch)
@@ -335,7 +343,7 @@ func temporaryConfig(condaYaml, requirementsText string, save bool, filenames ..
 	return hash, yaml, right, err
 }
 
-func LegacyEnvironment(force bool, configurations ...string) error {
+func LegacyEnvironment(force bool, layers Layers, configurations ...string) error {
 	cloud.BackgroundMetric(common.ControllerIdentity(), "rcc.env.create.start", common.Version)
 
 	lockfile := common.RobocorpLock()
@@ -360,7 +368,12 @@ func LegacyEnvironment(force bool, configurations ...string) error {
 	defer os.Remove(condaYaml)
 	defer os.Remove(requirementsText)
 
-	success, err := newLive(yaml, condaYaml, requirementsText, key, force, freshInstall, finalEnv.PostInstall)
+	layer, err := LayerBlueprint(finalEnv)
+	if err != nil {
+		return err
+	}
+
+	success, err := newLive(yaml, condaYaml, requirementsText, key, force, freshInstall, finalEnv.PostInstall, finalEnv.PrecompilePolicy(), layers, layer)
 	if err != nil {
 		return err
 	}
@@ -1,10 +1,11 @@
 module github.com/robocorp/rcc
 
-go 1.18
+go 1.22
 
 require (
 	github.com/dchest/siphash v1.2.2
 	github.com/google/shlex v0.0.0-20191202100458-e7afc7fbc510
+	github.com/klauspost/compress v1.18.0
 	github.com/mattn/go-isatty v0.0.14
 	github.com/spf13/cobra v1.5.0
 	github.com/spf13/viper v1.13.0
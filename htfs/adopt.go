@@ -0,0 +1,123 @@
+package htfs
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/robocorp/rcc/anywork"
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/fail"
+	"github.com/robocorp/rcc/pathlib"
+)
+
+const (
+	identityYaml = "identity.yaml"
+)
+
+func newAdoptedRelocation(source, target string) *relocation {
+	result := newRelocation(source, target)
+	// adopted directories can have generic names, so only full paths count
+	result.identity = []byte(source)
+	return result
+}
+
+func adoptIdentity(library MutableLibrary, fs *Root, blueprint []byte) (err error) {
+	defer fail.Around(&err)
+
+	digest := fmt.Sprintf("%02x", sha256.Sum256(blueprint))
+	fs.Tree.Files[identityYaml] = &File{
+		Name:    identityYaml,
+		Size:    int64(len(blueprint)),
+		Mode:    0o644,
+		Digest:  digest,
+		Rewrite: make([]int64, 0),
+	}
+	directory := library.Location(digest)
+	sinkpath := filepath.Join(directory, digest)
+	if pathlib.IsFile(sinkpath) {
+		return nil
+	}
+	pathlib.MakeSharedDir(directory)
+	source := filepath.Join(os.TempDir(), fmt.Sprintf("identity_%s.yaml", digest[:16]))
+	err = os.WriteFile(source, blueprint, 0o644)
+	fail.On(err != nil, "Could not write %q, reason: %v", source, err)
+	defer os.Remove(source)
+	anywork.Backlog(LiftFile(source, sinkpath))
+	return anywork.Sync()
+}
+
+// AdoptDirectory records existing directory into hololib as catalog of given
+// blueprint, without building it. Catalog remembers where it was adopted from,
+// and spaces restored from it are relocated from that directory.
+func AdoptDirectory(directory string, blueprint []byte) (catalog string, err error) {
+	defer fail.Around(&err)
+
+	fail.On(!pathlib.IsDir(directory), "Directory %q does not exist.", directory)
+	key := BlueprintHash(blueprint)
+	common.TimelineBegin("holotree adopt start [%s]", key)
+	defer common.TimelineEnd()
+
+	completed := pathlib.LockWaitMessage("Serialized environment adoption [holotree lock]")
+	locker, err := pathlib.SharedLocker(common.HolotreeLock(), 30000)
+	completed()
+	fail.On(err != nil, "Could not get lock for holotree. Quiting.")
+	defer locker.Release()
+
+	tree, err := New()
+	fail.On(err != nil, "%v", err)
+	library := tree.(*hololib)
+	completed = pathlib.LockWaitMessage("Serialized environment adoption [blueprint lock]")
+	blueprintLocker, err := pathlib.Locker(common.HolotreeBlueprintLock(key), 30000)
+	completed()
+	fail.On(err != nil, "Could not get lock for blueprint %q. Quiting.", key)
+	defer blueprintLocker.Release()
+	fail.On(tree.HasBlueprint(blueprint), "Blueprint %q is already in hololib, remove it first.", key)
+
+	fs, err := NewRoot(directory)
+	fail.On(err != nil, "%v", err)
+	source := fs.Path
+	fail.On(source == library.Stage(), "Cannot adopt holotree stage %q.", source)
+	fs.Bytecode = bytecodePolicy(blueprint)
+	err = fs.Lift()
+	fail.On(err != nil, "Failed to lift %q, reason: %v", source, err)
+	common.Timeline("holotree (re)locator start")
+	err = fs.AllFiles(Locator(source))
+	fail.On(err != nil, "Failed to locate %q, reason: %v", source, err)
+	common.Timeline("holotree (re)locator done")
+
+	score := &stats{}
+	common.Timeline("holotree adopt lift start %q", source)
+	err = fs.Treetop(ScheduleLifters(tree, score))
+	fail.On(err != nil, "Failed to lift objects from %q, reason: %v", source, err)
+	common.Timeline("holotree adopt lift done")
+	common.Debug("Holotree adopt workload: %d/%d\n", score.dirty, score.total)
+	err = adoptIdentity(tree, fs, blueprint)
+	fail.On(err != nil, "Failed to add %s, reason: %v", identityYaml, err)
+
+	// catalog lives in holotree like recorded ones, but content refers to
+	// adopted directory, so restores relocate from there
+	fs.Adopted = source
+	fs.Path = library.Stage()
+	fs.Identity = library.Identity()
+	fs.Blueprint = key
+	catalog = catalogFile(key)
+	err = fs.SaveAs(catalog)
+	fail.On(err != nil, "Failed to save catalog %q, reason: %v", catalog, err)
+	touchUsedHash(key)
+	return catalog, nil
+}
+
+// AdoptedCatalogs maps blueprints of adopted catalogs to directories they
+// were adopted from.
+func AdoptedCatalogs() map[string]string {
+	result := make(map[string]string)
+	_, roots := LoadCatalogHeaders()
+	for _, root := range roots {
+		if root != nil && len(root.Adopted) > 0 {
+			result[root.Blueprint] = root.Adopted
+		}
+	}
+	return result
+}
@@ -0,0 +1,40 @@
+package htfs
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/robocorp/rcc/hamlet"
+)
+
+func TestAdoptedRelocationMatchesOnlyFullSourcePath(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	adopted := newAdoptedRelocation("/home/user/envs/venv", "/opt/env")
+	text, ok, _ := adopted.Relocate([]byte("#!/home/user/envs/venv/bin/python\n"))
+	must.True(ok)
+	must.Equal("#!/opt/env/bin/python\n", string(text))
+
+	_, ok, _ = adopted.Relocate([]byte("import venv\n"))
+	must.True(ok)
+
+	_, ok, _ = newRelocation("/home/user/envs/venv", "/opt/env").Relocate([]byte("import venv\n"))
+	wont.True(ok)
+}
+
+func TestAdoptedSourceSurvivesCatalogHeader(t *testing.T) {
+	must, _ := hamlet.Specifications(t)
+
+	filename := filepath.Join(t.TempDir(), "catalog")
+	original := catalogFixture()
+	original.Adopted = "/home/user/envs/venv"
+	must.Nil(original.SaveAs(filename))
+
+	header := &Root{Tree: newDir("", "", false)}
+	must.Nil(header.LoadHeaderFrom(filename))
+	must.Equal(original.Adopted, header.Adopted)
+
+	reloaded := &Root{}
+	must.Nil(reloaded.LoadFrom(filename))
+	must.Equal(original.Adopted, reloaded.Adopted)
+}
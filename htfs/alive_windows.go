@@ -0,0 +1,17 @@
+//go:build windows
+// +build windows
+
+package htfs
+
+import (
+	"os"
+)
+
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
@@ -0,0 +1,424 @@
+package htfs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/fail"
+	"github.com/robocorp/rcc/pathlib"
+)
+
+const (
+	catalogMagic   = "RCCCATLG"
+	catalogVersion = 1
+)
+
+const (
+	flagRenamed = 1 << iota
+	flagSymlink
+	flagShadow
+	flagDigest
+)
+
+type catalogHeader struct {
+	RccVersion  string `json:"rcc"`
+	Identity    string `json:"identity"`
+	Path        string `json:"path"`
+	Controller  string `json:"controller"`
+	Space       string `json:"space"`
+	Platform    string `json:"platform"`
+	Blueprint   string `json:"blueprint"`
+	Lifted      bool   `json:"lifted"`
+	Pool        string `json:"pool,omitempty"`
+	PoolSize    int    `json:"pool-size,omitempty"`
+	Protected   bool   `json:"protected,omitempty"`
+	Bytecode    string `json:"bytecode,omitempty"`
+	Adopted     string `json:"adopted,omitempty"`
+	Directories uint64 `json:"directories"`
+	Files       uint64 `json:"files"`
+	Bytes       uint64 `json:"bytes"`
+	Library     string `json:"identity.yaml"`
+}
+
+type catalogWriter struct {
+	*bufio.Writer
+	scratch [binary.MaxVarintLen64]byte
+}
+
+type catalogReader struct {
+	*bufio.Reader
+}
+
+func summarize(dir *Dir, stats *TreeStats) {
+	stats.Directories += 1
+	stats.Files += uint64(len(dir.Files))
+	for _, file := range dir.Files {
+		stats.Bytes += uint64(file.Size)
+		if file.Name == "identity.yaml" {
+			stats.Identity = guessLocation(file.Digest)
+		}
+	}
+	for _, subdir := range dir.Dirs {
+		summarize(subdir, stats)
+	}
+}
+
+func (it *Root) header() *catalogHeader {
+	stats := &TreeStats{}
+	summarize(it.Tree, stats)
+	return &catalogHeader{
+		RccVersion:  it.RccVersion,
+		Identity:    it.Identity,
+		Path:        it.Path,
+		Controller:  it.Controller,
+		Space:       it.Space,
+		Platform:    it.Platform,
+		Blueprint:   it.Blueprint,
+		Lifted:      it.Lifted,
+		Pool:        it.Pool,
+		PoolSize:    it.PoolSize,
+		Protected:   it.Protected,
+		Bytecode:    it.Bytecode,
+		Adopted:     it.Adopted,
+		Directories: stats.Directories,
+		Files:       stats.Files,
+		Bytes:       stats.Bytes,
+		Library:     stats.Identity,
+	}
+}
+
+func (it *Root) adopt(header *catalogHeader) {
+	it.RccVersion = header.RccVersion
+	it.Identity = header.Identity
+	it.Path = header.Path
+	it.Controller = header.Controller
+	it.Space = header.Space
+	it.Platform = header.Platform
+	it.Blueprint = header.Blueprint
+	it.Lifted = header.Lifted
+	it.Pool = header.Pool
+	it.PoolSize = header.PoolSize
+	it.Protected = header.Protected
+	it.Bytecode = header.Bytecode
+	it.Adopted = header.Adopted
+	it.summary = &TreeStats{
+		Directories: header.Directories,
+		Files:       header.Files,
+		Bytes:       header.Bytes,
+		Identity:    header.Library,
+	}
+}
+
+func (it *catalogWriter) number(value uint64) {
+	size := binary.PutUvarint(it.scratch[:], value)
+	it.Write(it.scratch[:size])
+}
+
+func (it *catalogWriter) text(value string) {
+	it.number(uint64(len(value)))
+	it.WriteString(value)
+}
+
+func sortedKeys[T any](entries map[string]T) []string {
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (it *catalogWriter) file(key string, file *File) {
+	digest, err := hex.DecodeString(file.Digest)
+	flags := uint64(0)
+	if file.Name != key {
+		flags |= flagRenamed
+	}
+	if file.IsSymlink() {
+		flags |= flagSymlink
+	}
+	if err == nil && len(digest) == 32 {
+		flags |= flagDigest
+	}
+	it.text(key)
+	it.number(flags)
+	if flags&flagRenamed != 0 {
+		it.text(file.Name)
+	}
+	if flags&flagSymlink != 0 {
+		it.text(file.Symlink)
+	}
+	it.number(uint64(file.Size))
+	it.number(uint64(file.Mode))
+	if flags&flagDigest != 0 {
+		it.Write(digest)
+	} else {
+		it.text(file.Digest)
+	}
+	it.number(uint64(len(file.Rewrite)))
+	for _, offset := range file.Rewrite {
+		it.number(uint64(offset))
+	}
+}
+
+func (it *catalogWriter) dir(key string, dir *Dir) {
+	flags := uint64(0)
+	if dir.Name != key {
+		flags |= flagRenamed
+	}
+	if dir.IsSymlink() {
+		flags |= flagSymlink
+	}
+	if dir.Shadow {
+		flags |= flagShadow
+	}
+	it.text(key)
+	it.number(flags)
+	if flags&flagRenamed != 0 {
+		it.text(dir.Name)
+	}
+	if flags&flagSymlink != 0 {
+		it.text(dir.Symlink)
+	}
+	it.number(uint64(dir.Mode))
+	it.number(uint64(len(dir.Files)))
+	for _, name := range sortedKeys(dir.Files) {
+		it.file(name, dir.Files[name])
+	}
+	it.number(uint64(len(dir.Dirs)))
+	for _, name := range sortedKeys(dir.Dirs) {
+		it.dir(name, dir.Dirs[name])
+	}
+}
+
+func (it *catalogReader) number() uint64 {
+	value, err := binary.ReadUvarint(it)
+	fail.On(err != nil, "Catalog tree is truncated, reason: %v", err)
+	return value
+}
+
+func (it *catalogReader) text() string {
+	size := it.number()
+	fail.On(size > 1<<20, "Catalog tree is corrupted, text size %d is too big.", size)
+	buffer := make([]byte, size)
+	_, err := io.ReadFull(it, buffer)
+	fail.On(err != nil, "Catalog tree is truncated, reason: %v", err)
+	return string(buffer)
+}
+
+func (it *catalogReader) file() (string, *File) {
+	key := it.text()
+	flags := it.number()
+	file := &File{Name: key}
+	if flags&flagRenamed != 0 {
+		file.Name = it.text()
+	}
+	if flags&flagSymlink != 0 {
+		file.Symlink = it.text()
+	}
+	file.Size = int64(it.number())
+	file.Mode = fs.FileMode(it.number())
+	if flags&flagDigest != 0 {
+		digest := make([]byte, 32)
+		_, err := io.ReadFull(it, digest)
+		fail.On(err != nil, "Catalog tree is truncated, reason: %v", err)
+		file.Digest = hex.EncodeToString(digest)
+	} else {
+		file.Digest = it.text()
+	}
+	file.Rewrite = make([]int64, it.number())
+	for at := range file.Rewrite {
+		file.Rewrite[at] = int64(it.number())
+	}
+	return key, file
+}
+
+func (it *catalogReader) dir() (string, *Dir) {
+	key := it.text()
+	flags := it.number()
+	dir := newDir(key, "", flags&flagShadow != 0)
+	if flags&flagRenamed != 0 {
+		dir.Name = it.text()
+	}
+	if flags&flagSymlink != 0 {
+		dir.Symlink = it.text()
+	}
+	dir.Mode = fs.FileMode(it.number())
+	for count := it.number(); count > 0; count-- {
+		name, file := it.file()
+		dir.Files[name] = file
+	}
+	for count := it.number(); count > 0; count-- {
+		name, subdir := it.dir()
+		dir.Dirs[name] = subdir
+	}
+	return key, dir
+}
+
+func (it *Root) writeCatalog(sink io.Writer) (err error) {
+	defer fail.Around(&err)
+
+	header, err := json.Marshal(it.header())
+	fail.On(err != nil, "%v", err)
+	prefix := bytes.NewBufferString(catalogMagic)
+	binary.Write(prefix, binary.BigEndian, uint16(catalogVersion))
+	binary.Write(prefix, binary.BigEndian, uint32(len(header)))
+	prefix.Write(header)
+	_, err = sink.Write(prefix.Bytes())
+	fail.On(err != nil, "%v", err)
+	encoder, err := zstd.NewWriter(sink, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+	fail.On(err != nil, "%v", err)
+	writer := &catalogWriter{Writer: bufio.NewWriter(encoder)}
+	writer.dir("", it.Tree)
+	err = writer.Flush()
+	fail.On(err != nil, "%v", err)
+	return encoder.Close()
+}
+
+func isBinaryCatalog(source *bufio.Reader) bool {
+	magic, _ := source.Peek(len(catalogMagic))
+	return string(magic) == catalogMagic
+}
+
+func readCatalogHeader(source *bufio.Reader) (header *catalogHeader, err error) {
+	defer fail.Around(&err)
+
+	prefix := make([]byte, len(catalogMagic)+6)
+	_, err = io.ReadFull(source, prefix)
+	fail.On(err != nil, "Catalog header is truncated, reason: %v", err)
+	version := binary.BigEndian.Uint16(prefix[len(catalogMagic):])
+	fail.On(version > catalogVersion, "Catalog format version %d is newer than supported version %d.", version, catalogVersion)
+	size := binary.BigEndian.Uint32(prefix[len(catalogMagic)+2:])
+	content := make([]byte, size)
+	_, err = io.ReadFull(source, content)
+	fail.On(err != nil, "Catalog header is truncated, reason: %v", err)
+	header = &catalogHeader{}
+	err = json.Unmarshal(content, header)
+	fail.On(err != nil, "Catalog header is corrupted, reason: %v", err)
+	return header, nil
+}
+
+func (it *Root) readCatalog(source *bufio.Reader, headerOnly bool) (err error) {
+	defer fail.Around(&err)
+
+	header, err := readCatalogHeader(source)
+	fail.On(err != nil, "%v", err)
+	it.adopt(header)
+	if headerOnly {
+		return nil
+	}
+	decoder, err := zstd.NewReader(source, zstd.WithDecoderConcurrency(1))
+	fail.On(err != nil, "%v", err)
+	defer decoder.Close()
+	_, it.Tree = (&catalogReader{bufio.NewReader(decoder)}).dir()
+	it.summary = nil
+	return nil
+}
+
+func (it *Root) loadCatalog(filename string, headerOnly bool) (err error) {
+	defer fail.Around(&err)
+
+	source, err := os.Open(filename)
+	fail.On(err != nil, "%v", err)
+	defer source.Close()
+	reader, err := Decompressed(source)
+	fail.On(err != nil, "%v", err)
+	defer reader.Close()
+	buffered := bufio.NewReader(reader)
+	it.source = filename
+	it.legacy = !isBinaryCatalog(buffered)
+	if it.legacy {
+		err = json.NewDecoder(buffered).Decode(&it)
+		fail.On(err != nil, "%v", err)
+		return nil
+	}
+	return it.readCatalog(buffered, headerOnly)
+}
+
+func (it *Root) complete() error {
+	if it.summary == nil {
+		return nil
+	}
+	return it.loadCatalog(it.source, false)
+}
+
+func (it *Root) LoadHeaderFrom(filename string) error {
+	common.TimelineBegin("holotree header load %q", filename)
+	defer common.TimelineEnd()
+	return it.loadCatalog(filename, true)
+}
+
+func migrateCatalog(legacy, catalog string) (err error) {
+	defer fail.Around(&err)
+
+	root := &Root{}
+	err = root.LoadFrom(legacy)
+	fail.On(err != nil, "%v", err)
+	fail.On(!root.legacy, "Catalog %q is not in legacy format.", legacy)
+	partname := filepath.Join(filepath.Dir(catalog), fmt.Sprintf("migrate_%s.part%s", filepath.Base(catalog), <-common.Identities))
+	defer os.Remove(partname)
+	err = root.SaveAs(partname)
+	fail.On(err != nil, "%v", err)
+	err = TryRename("migrate", partname, catalog)
+	fail.On(err != nil, "%v", err)
+	pathlib.MakeSharedFile(catalog)
+	return nil
+}
+
+// migrateLegacyCatalog writes binary copy of unsigned legacy catalog, unless
+// there already is one. Legacy catalog is left as is and binary one appears
+// with atomic rename, so this is safe also under shared blueprint lock.
+func migrateLegacyCatalog(legacy string) (migrated, signed bool, err error) {
+	catalog := filepath.Join(filepath.Dir(legacy), strings.Replace(filepath.Base(legacy), legacyCatalogSuffix, catalogSuffix, 1))
+	if pathlib.IsFile(catalog) {
+		return false, false, nil
+	}
+	if pathlib.IsFile(SignatureLocation(legacy)) {
+		common.Debug("Catalog %q is signed, and is not migrated to binary format.", legacy)
+		return false, true, nil
+	}
+	err = migrateCatalog(legacy, catalog)
+	if err != nil {
+		return false, false, fmt.Errorf("Catalog %q migration to binary format failed, reason: %v", legacy, err)
+	}
+	common.Debug("Catalog %q migrated to binary format.", legacy)
+	return true, false, nil
+}
+
+// MigrateCatalogs writes binary copies of all legacy JSON catalogs at once,
+// which otherwise happens one by one, when they are first used. Legacy
+// catalogs are left in place for older rcc versions, and signed ones are
+// skipped, since signature would not match.
+func MigrateCatalogs() (migrated, skipped int, err error) {
+	defer fail.Around(&err)
+
+	completed := pathlib.LockWaitMessage("Serialized catalog migration [holotree lock]")
+	locker, err := pathlib.Locker(common.HolotreeLock(), 30000)
+	completed()
+	fail.On(err != nil, "Could not get lock for holotree. Quiting.")
+	defer locker.Release()
+
+	for _, name := range LegacyCatalogs() {
+		done, signed, err := migrateLegacyCatalog(filepath.Join(common.HololibCatalogLocation(), name))
+		fail.On(err != nil, "%v", err)
+		if done {
+			migrated += 1
+		}
+		if signed {
+			skipped += 1
+		}
+	}
+	return migrated, skipped, nil
+}
@@ -0,0 +1,165 @@
+package htfs
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/hamlet"
+	"github.com/robocorp/rcc/pathlib"
+)
+
+func catalogFixture() *Root {
+	root := &Root{
+		RccVersion: "v11.46.0",
+		Identity:   "h1234_abcdeft",
+		Path:       "/home/user/holotree/h1234_abcdeft",
+		Platform:   "linux_amd64",
+		Blueprint:  "1234567890abcdef",
+		Lifted:     true,
+		Tree:       newDir("", "", false),
+	}
+	bin := newDir("bin", "", false)
+	bin.Mode = 0o755
+	bin.Files["python"] = &File{Name: "python", Size: 120, Mode: 0o755, Digest: "944c96481dbe2f1e51b79e489fa54d503c6ba051d5f1a5952f68327016278fae", Rewrite: []int64{12, 300}}
+	bin.Files["python3"] = &File{Name: "python3", Symlink: "python", Mode: 0o777, Digest: "N/A", Rewrite: []int64{}}
+	root.Tree.Dirs["bin"] = bin
+	root.Tree.Dirs["lib64"] = newDir("lib", "lib", true)
+	root.Tree.Files["identity.yaml"] = &File{Name: "identity.yaml", Size: 8, Mode: 0o644, Digest: "7c321dccfe2da18cc0b1037845ae1514ffcec25d5513b65feb9c495446112ca3", Rewrite: []int64{}}
+	return root
+}
+
+func TestBinaryCatalogRoundtripAndHeader(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	filename := filepath.Join(t.TempDir(), "catalog")
+	original := catalogFixture()
+	must.Nil(original.SaveAs(filename))
+	expected, err := original.AsJson()
+	must.Nil(err)
+
+	reloaded := &Root{}
+	must.Nil(reloaded.LoadFrom(filename))
+	wont.True(reloaded.legacy)
+	must.Nil(reloaded.summary)
+	actual, err := reloaded.AsJson()
+	must.Nil(err)
+	must.Equal(string(expected), string(actual))
+
+	header := &Root{Tree: newDir("", "", false)}
+	must.Nil(header.LoadHeaderFrom(filename))
+	must.Equal(original.Blueprint, header.Blueprint)
+	must.Equal(original.Path, header.Path)
+	must.Equal(0, len(header.Tree.Dirs))
+	stats, err := header.Stats()
+	must.Nil(err)
+	must.Equal(uint64(3), stats.Directories)
+	must.Equal(uint64(3), stats.Files)
+	must.Equal(uint64(128), stats.Bytes)
+	must.Equal("7c/32/1d/7c321dccfe2da18cc0b1037845ae1514ffcec25d5513b65feb9c495446112ca3", stats.Identity)
+
+	must.Nil(header.complete())
+	actual, err = header.AsJson()
+	must.Nil(err)
+	must.Equal(string(expected), string(actual))
+}
+
+func legacyCatalogFixture(filename string, root *Root) error {
+	content, err := root.AsJson()
+	if err != nil {
+		return err
+	}
+	sink, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+	writer := gzip.NewWriter(sink)
+	writer.Write(content)
+	return writer.Close()
+}
+
+func TestLegacyJsonCatalogsAreStillReadable(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	filename := filepath.Join(t.TempDir(), "legacy")
+	original := catalogFixture()
+	content, err := original.AsJson()
+	must.Nil(err)
+	must.Nil(legacyCatalogFixture(filename, original))
+
+	reloaded := &Root{}
+	must.Nil(reloaded.LoadHeaderFrom(filename))
+	must.True(reloaded.legacy)
+	must.Nil(reloaded.summary)
+	actual, err := reloaded.AsJson()
+	must.Nil(err)
+	must.Equal(string(content), string(actual))
+
+	broken := filepath.Join(t.TempDir(), "broken")
+	must.Nil(os.WriteFile(broken, []byte(catalogMagic+"\x00\x09"), 0o644))
+	wont.Nil(reloaded.LoadFrom(broken))
+}
+
+func TestLegacyCatalogsAreMigratedInBulkOnRequest(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	t.Setenv("ROBOCORP_HOME", t.TempDir())
+	must.Nil(os.MkdirAll(common.HololibCatalogLocation(), 0o755))
+	original := catalogFixture()
+	name := legacyCatalogName(original.Blueprint)
+	legacy := filepath.Join(common.HololibCatalogLocation(), name)
+	must.Nil(legacyCatalogFixture(legacy, original))
+
+	must.Equal(0, len(Catalogs()))
+	must.Equal([]string{name}, LegacyCatalogs())
+	marked, count, err := MarkReferencedDigests()
+	must.Nil(err)
+	must.Equal(1, count)
+	must.True(marked[original.Tree.Dirs["bin"].Files["python"].Digest])
+	must.Equal(0, len(Catalogs()))
+
+	migrated, skipped, err := MigrateCatalogs()
+	must.Nil(err)
+	must.Equal(1, migrated)
+	must.Equal(0, skipped)
+	must.Equal([]string{CatalogName(original.Blueprint)}, Catalogs())
+	must.True(pathlib.IsFile(legacy))
+
+	reloaded := &Root{}
+	must.Nil(reloaded.LoadFrom(filepath.Join(common.HololibCatalogLocation(), CatalogName(original.Blueprint))))
+	wont.True(reloaded.legacy)
+	must.Equal(original.Blueprint, reloaded.Blueprint)
+
+	migrated, _, err = MigrateCatalogs()
+	must.Nil(err)
+	must.Equal(0, migrated)
+}
+
+func TestLegacyCatalogsAreMigratedOnFirstUse(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	t.Setenv("ROBOCORP_HOME", t.TempDir())
+	library, err := New()
+	must.Nil(err)
+	original := catalogFixture()
+	delete(original.Tree.Dirs["bin"].Files, "python3")
+	legacy := filepath.Join(common.HololibCatalogLocation(), legacyCatalogName(original.Blueprint))
+	must.Nil(legacyCatalogFixture(legacy, original))
+	catalog := filepath.Join(common.HololibCatalogLocation(), CatalogName(original.Blueprint))
+
+	must.Equal(legacy, library.CatalogPath(original.Blueprint))
+	wont.True(library.(*hololib).queryBlueprint(original.Blueprint))
+	wont.True(pathlib.IsFile(catalog))
+
+	for _, digest := range []string{original.Tree.Dirs["bin"].Files["python"].Digest, original.Tree.Files["identity.yaml"].Digest} {
+		must.Nil(libraryObjectFixture(library.ExactLocation(digest)))
+	}
+	must.True(library.(*hololib).queryBlueprint(original.Blueprint))
+	must.True(pathlib.IsFile(catalog))
+	must.True(pathlib.IsFile(legacy))
+	must.Equal(catalog, library.CatalogPath(original.Blueprint))
+	must.Equal([]string{CatalogName(original.Blueprint)}, Catalogs())
+}
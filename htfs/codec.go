@@ -0,0 +1,106 @@
+package htfs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/robocorp/rcc/settings"
+)
+
+const (
+	CodecGzip = "gzip"
+	CodecZstd = "zstd"
+	CodecNone = "none"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+type Codec interface {
+	Name() string
+	Writer(io.Writer) (io.WriteCloser, error)
+}
+
+type gzipCodec int
+type zstdCodec int
+
+func (it gzipCodec) Name() string {
+	return CodecGzip
+}
+
+func (it gzipCodec) Writer(sink io.Writer) (io.WriteCloser, error) {
+	level := int(it)
+	if level < gzip.BestSpeed || level > gzip.BestCompression {
+		level = gzip.BestSpeed
+	}
+	return gzip.NewWriterLevel(sink, level)
+}
+
+func (it zstdCodec) Name() string {
+	return CodecZstd
+}
+
+func (it zstdCodec) Writer(sink io.Writer) (io.WriteCloser, error) {
+	level := zstd.SpeedDefault
+	if it > 0 {
+		level = zstd.EncoderLevelFromZstd(int(it))
+	}
+	return zstd.NewWriter(sink, zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(1))
+}
+
+func ObjectCodec() Codec {
+	level := settings.Global.HolotreeCodecLevel()
+	switch strings.ToLower(strings.TrimSpace(settings.Global.HolotreeCodec())) {
+	case CodecGzip:
+		return gzipCodec(level)
+	default:
+		return zstdCodec(level)
+	}
+}
+
+type decoder struct {
+	io.Reader
+	closer func()
+}
+
+func (it *decoder) Close() error {
+	it.closer()
+	return nil
+}
+
+func nothingToClose() {}
+
+func SniffCodec(source io.Reader) (string, io.Reader) {
+	buffered := bufio.NewReader(source)
+	header, _ := buffered.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(header, zstdMagic):
+		return CodecZstd, buffered
+	case bytes.HasPrefix(header, gzipMagic):
+		return CodecGzip, buffered
+	default:
+		return CodecNone, buffered
+	}
+}
+
+func Decompressed(source io.Reader) (io.ReadCloser, error) {
+	codec, reader := SniffCodec(source)
+	switch codec {
+	case CodecZstd:
+		unzstd, err := zstd.NewReader(reader, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return &decoder{unzstd, unzstd.Close}, nil
+	case CodecGzip:
+		return gzip.NewReader(reader)
+	default:
+		return &decoder{reader, nothingToClose}, nil
+	}
+}
@@ -0,0 +1,73 @@
+package htfs_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/robocorp/rcc/hamlet"
+	"github.com/robocorp/rcc/htfs"
+)
+
+func roundtrip(t *testing.T, content []byte, compress func(io.Writer) io.WriteCloser) (string, []byte) {
+	must, _ := hamlet.Specifications(t)
+
+	sink := bytes.NewBuffer(nil)
+	writer := compress(sink)
+	_, err := writer.Write(content)
+	must.Nil(err)
+	must.Nil(writer.Close())
+
+	codec, _ := htfs.SniffCodec(bytes.NewReader(sink.Bytes()))
+	reader, err := htfs.Decompressed(bytes.NewReader(sink.Bytes()))
+	must.Nil(err)
+	defer reader.Close()
+	result, err := io.ReadAll(reader)
+	must.Nil(err)
+	return codec, result
+}
+
+func TestCodecsCanBeSniffedAndDecompressed(t *testing.T) {
+	must, _ := hamlet.Specifications(t)
+
+	content := bytes.Repeat([]byte("holotree library object content\n"), 1000)
+
+	codec, result := roundtrip(t, content, func(sink io.Writer) io.WriteCloser {
+		writer, _ := gzip.NewWriterLevel(sink, gzip.BestSpeed)
+		return writer
+	})
+	must.Equal(htfs.CodecGzip, codec)
+	must.Equal(content, result)
+
+	codec, result = roundtrip(t, content, func(sink io.Writer) io.WriteCloser {
+		writer, _ := zstd.NewWriter(sink)
+		return writer
+	})
+	must.Equal(htfs.CodecZstd, codec)
+	must.Equal(content, result)
+
+	codec, result = roundtrip(t, content, func(sink io.Writer) io.WriteCloser {
+		writer, _ := htfs.ObjectCodec().Writer(sink)
+		return writer
+	})
+	must.Equal(htfs.CodecZstd, codec)
+	must.Equal(content, result)
+
+	codec, result = roundtrip(t, []byte("x"), nopCompress)
+	must.Equal(htfs.CodecNone, codec)
+	must.Equal([]byte("x"), result)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (it nopWriteCloser) Close() error {
+	return nil
+}
+
+func nopCompress(sink io.Writer) io.WriteCloser {
+	return nopWriteCloser{sink}
+}
@@ -53,11 +53,14 @@ func NewEnvironment(condafile, holozip string, restore, force bool) (label strin
 		common.Progress(1, "Fresh [private mode] holotree environment %v.", xviper.TrackingIdentity())
 	}
 
-	completed := pathlib.LockWaitMessage("Serialized environment creation [holotree lock]")
-	locker, err := pathlib.Locker(common.HolotreeLock(), 30000)
-	completed()
-	fail.On(err != nil, "Could not get lock for holotree. Quiting.")
-	defer locker.Release()
+	// eviction needs exclusive holotree lock, so it runs after shared lock
+	// below is released
+	recorded := false
+	defer func() {
+		if recorded {
+			EvictOpportunistically()
+		}
+	}()
 
 	_, holotreeBlueprint, err := ComposeFinalBlueprint([]string{condafile}, "")
 	fail.On(err != nil, "%s", err)
@@ -67,6 +70,34 @@ func NewEnvironment(condafile, holozip string, restore, force bool) (label strin
 
 	tree, err := New()
 	fail.On(err != nil, "%s", err)
+	var library Library
+	if haszip {
+		library, err = ZipLibrary(holozip)
+		fail.On(err != nil, "Failed to load %q -> %s", holozip, err)
+	}
+
+	// lease may have to wait for another robot run to end, so it is taken
+	// before holotree and blueprint locks, which would block everyone else
+	if restore {
+		leased := Library(tree)
+		if haszip {
+			leased = library
+		}
+		err = LeaseSpace(leased, holotreeBlueprint)
+		fail.On(err != nil, "%v", err)
+	}
+
+	locker, err := lockHolotree()
+	fail.On(err != nil, "Could not get lock for holotree. Quiting.")
+	defer locker.Release()
+
+	blueprintLocker, err := lockBlueprint(tree, holotreeBlueprint, force && !haszip)
+	fail.On(err != nil, "Could not get lock for blueprint %q. Quiting.", common.EnvironmentHash)
+	defer blueprintLocker.Release()
+
+	if !haszip && !force && !common.UnmanagedSpace && !tree.HasBlueprint(holotreeBlueprint) {
+		PullRemoteBlueprint(tree, holotreeBlueprint)
+	}
 
 	if !haszip && !tree.HasBlueprint(holotreeBlueprint) && common.Liveonly {
 		tree = Virtual()
@@ -78,13 +109,11 @@ func NewEnvironment(condafile, holozip string, restore, force bool) (label strin
 	err = tree.ValidateBlueprint(holotreeBlueprint)
 	fail.On(err != nil, "%s", err)
 	scorecard = common.NewScorecard()
-	var library Library
 	if haszip {
-		library, err = ZipLibrary(holozip)
-		fail.On(err != nil, "Failed to load %q -> %s", holozip, err)
 		common.Timeline("downgraded to holotree zip library")
 	} else {
 		scorecard.Start()
+		recorded = force || !tree.HasBlueprint(holotreeBlueprint)
 		err = RecordEnvironment(tree, holotreeBlueprint, force, scorecard)
 		fail.On(err != nil, "%s", err)
 		library = tree
@@ -94,6 +123,7 @@ func NewEnvironment(condafile, holozip string, restore, force bool) (label strin
 		common.Progress(12, "Restore space from library [with %d workers].", anywork.Scale())
 		path, err = library.Restore(holotreeBlueprint, []byte(common.ControllerIdentity()), []byte(common.HolotreeSpace))
 		fail.On(err != nil, "Failed to restore blueprint %q, reason: %v", string(holotreeBlueprint), err)
+		MarkSpaceUsed(path)
 		journal.CurrentBuildEvent().RestoreComplete()
 	} else {
 		common.Progress(12, "Restoring space skipped.")
@@ -102,6 +132,67 @@ func NewEnvironment(condafile, holozip string, restore, force bool) (label strin
 	return path, scorecard, nil
 }
 
+// lockHolotree is shared for normal restores, but liveonly builds may restore
+// straight from holotree stage (virtual library), and that stage must not be
+// cleaned up by other builds until restore is done.
+//
+// Recording also holds only shared holotree lock. Writers of same blueprint
+// are serialized by exclusive blueprint lock, and use of stage by exclusive
+// stage lock. Sweeping operations (gc, evict, repack, prune, delete, import)
+// take exclusive holotree lock, so they cannot run while any shared holder is
+// recording into, or restoring from, hololib.
+func lockHolotree() (pathlib.Releaser, error) {
+	completed := pathlib.LockWaitMessage("Serialized environment creation [holotree lock]")
+	defer completed()
+	if common.Liveonly {
+		return pathlib.Locker(common.HolotreeLock(), 30000)
+	}
+	return pathlib.SharedLocker(common.HolotreeLock(), 30000)
+}
+
+func lockBlueprint(tree MutableLibrary, blueprint []byte, exclusive bool) (pathlib.Releaser, error) {
+	key := BlueprintHash(blueprint)
+	lockfile := common.HolotreeBlueprintLock(key)
+	if !exclusive {
+		completed := pathlib.LockWaitMessage("Serialized environment restore [blueprint lock]")
+		locker, err := pathlib.SharedLocker(lockfile, 30000)
+		completed()
+		if err != nil {
+			return nil, err
+		}
+		if tree.HasBlueprint(blueprint) {
+			common.Timeline("shared blueprint lock %q", key)
+			return locker, nil
+		}
+		locker.Release()
+		forgetBlueprint(tree, key)
+	}
+	completed := pathlib.LockWaitMessage("Serialized environment creation [blueprint lock]")
+	defer completed()
+	common.Timeline("exclusive blueprint lock %q", key)
+	return pathlib.Locker(lockfile, 30000)
+}
+
+func PullRemoteBlueprint(tree MutableLibrary, blueprint []byte) bool {
+	link := RemoteLibraryURL()
+	if len(link) == 0 {
+		return false
+	}
+	key := BlueprintHash(blueprint)
+	remote := RemoteLibrary(link, tree)
+	if !remote.HasBlueprint(blueprint) {
+		common.Debug("Remote hololib %q does not have blueprint %q.", link, key)
+		return false
+	}
+	common.Progress(2, "Pulling blueprint %q from remote hololib %q.", key, link)
+	err := remote.(*remotelib).Pull(blueprint)
+	if err != nil {
+		pretty.Warning("Remote hololib pull failed, falling back to local build, reason: %v", err)
+		return false
+	}
+	return tree.HasBlueprint(blueprint)
+}
+
 func CleanupHolotreeStage(tree MutableLibrary) error {
 	common.Timeline("holotree stage removal start")
 	defer common.Timeline("holotree stage removal done")
@@ -124,6 +215,12 @@ func RecordEnvironment(tree MutableLibrary, blueprint []byte, force bool, scorec
 	common.Debug("Has blueprint environment: %v", exists)
 
 	if force || !exists {
+		completed := pathlib.LockWaitMessage("Serialized environment creation [holotree stage lock]")
+		locker, err := pathlib.Locker(common.HolotreeStageLock(), 30000)
+		completed()
+		fail.On(err != nil, "Could not get lock for holotree stage. Quiting.")
+		defer locker.Release()
+
 		common.Progress(3, "Cleanup holotree stage for fresh install.")
 		fail.On(settings.Global.NoBuild(), "Building new holotree environment is blocked by settings, and could not be found from hololib cache!")
 		err = CleanupHolotreeStage(tree)
@@ -137,7 +234,7 @@ func RecordEnvironment(tree MutableLibrary, blueprint []byte, force bool, scorec
 		identityfile := filepath.Join(tree.Stage(), "identity.yaml")
 		err = ioutil.WriteFile(identityfile, blueprint, 0o644)
 		fail.On(err != nil, "Failed to save %q, reason %w.", identityfile, err)
-		err = conda.LegacyEnvironment(force, identityfile)
+		err = conda.LegacyEnvironment(force, CondaLayers(tree), identityfile)
 		fail.On(err != nil, "Failed to create environment, reason %w.", err)
 
 		scorecard.Midpoint()
@@ -175,14 +272,26 @@ func RemoveHolotreeSpace(label string) (err error) {
 		if name != label {
 			continue
 		}
-		TryRemove("metafile", metafile)
 		TryRemove("lockfile", directory+".lck")
-		err = TryRemoveAll("space", directory)
-		fail.On(err != nil, "Problem removing %q, reason: %s.", directory, err)
+		err = removeSpace(directory, metafile)
+		fail.On(err != nil, "%v", err)
 	}
 	return nil
 }
 
+func removeSpace(directory, metafile string) (err error) {
+	defer fail.Around(&err)
+
+	TryRemove("metafile", metafile)
+	os.Remove(LeaseFile(directory))
+	os.Remove(LastUsedFile(directory))
+	os.Remove(LastRunFile(directory))
+	removeGenerations(directory)
+	err = TryRemoveAll("space", directory)
+	fail.On(err != nil, "Problem removing %q, reason: %s.", directory, err)
+	return nil
+}
+
 func RobotBlueprints(userBlueprints []string, packfile string) (robot.Robot, []string) {
 	var err error
 	var config robot.Robot
@@ -217,6 +326,11 @@ func ComposeFinalBlueprint(userFiles []string, packfile string) (config robot.Ro
 		fail.On(err != nil, "Failure: %v", err)
 	}
 	fail.On(right == nil, "Missing environment specification(s).")
+	// default bytecode policy comes from machine local settings, so resolved
+	// policy is made part of blueprint, and so also part of its hash
+	if policy := right.PrecompilePolicy(); policy != conda.PrecompileNone {
+		right.Precompile = policy
+	}
 	content, err := right.AsYaml()
 	fail.On(err != nil, "YAML error: %v", err)
 	return config, []byte(strings.TrimSpace(content)), nil
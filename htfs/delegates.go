@@ -1,22 +1,21 @@
 package htfs
 
 import (
-	"compress/gzip"
 	"io"
 	"os"
 
 	"github.com/robocorp/rcc/fail"
 )
 
-func gzDelegateOpen(filename string, ungzip bool) (readable io.Reader, closer Closer, err error) {
+func codecDelegateOpen(filename string, decompress bool) (readable io.Reader, closer Closer, err error) {
 	defer fail.Around(&err)
 
 	source, err := os.Open(filename)
 	fail.On(err != nil, "Failed to open %q -> %v", filename, err)
 
 	var reader io.ReadCloser
-	reader, err = gzip.NewReader(source)
-	if err != nil || !ungzip {
+	reader, err = Decompressed(source)
+	if err != nil || !decompress {
 		_, err = source.Seek(0, 0)
 		fail.On(err != nil, "Failed to seek %q -> %v", filename, err)
 		reader = source
@@ -28,6 +27,10 @@ func gzDelegateOpen(filename string, ungzip bool) (readable io.Reader, closer Cl
 	return reader, closer, nil
 }
 
-func delegateOpen(it MutableLibrary, digest string, ungzip bool) (readable io.Reader, closer Closer, err error) {
-	return gzDelegateOpen(it.ExactLocation(digest), ungzip)
+func delegateOpen(it MutableLibrary, digest string, decompress bool) (readable io.Reader, closer Closer, err error) {
+	readable, closer, err = codecDelegateOpen(it.ExactLocation(digest), decompress)
+	if err != nil && IsPacked(digest) {
+		return packedDelegateOpen(digest, decompress)
+	}
+	return readable, closer, err
 }
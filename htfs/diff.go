@@ -0,0 +1,262 @@
+package htfs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/conda"
+	"github.com/robocorp/rcc/fail"
+	"github.com/robocorp/rcc/pathlib"
+)
+
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+type DiffEntry struct {
+	Path    string `json:"path"`
+	Kind    string `json:"kind"`
+	Symlink string `json:"symlink,omitempty"`
+	Size    int64  `json:"size"`
+	Mode    string `json:"mode"`
+	Digest  string `json:"digest,omitempty"`
+}
+
+type Difference struct {
+	Path   string     `json:"path"`
+	Status string     `json:"status"`
+	Before *DiffEntry `json:"before,omitempty"`
+	After  *DiffEntry `json:"after,omitempty"`
+}
+
+type Differences []*Difference
+
+func (it Differences) Count(status string) int {
+	total := 0
+	for _, entry := range it {
+		if entry.Status == status {
+			total += 1
+		}
+	}
+	return total
+}
+
+type DiffSide struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Blueprint string `json:"blueprint"`
+	Source    string `json:"source"`
+	root      *Root
+}
+
+func (it *DiffSide) Root() *Root {
+	return it.root
+}
+
+func (it *DiffSide) Dependencies() []byte {
+	if it.Kind == "space" {
+		body, err := os.ReadFile(conda.GoldenMasterFilename(it.root.Path))
+		if err == nil {
+			return body
+		}
+	}
+	body, err := it.root.Show(filepath.Base(conda.GoldenMasterFilename(".")))
+	if err != nil {
+		return nil
+	}
+	return body
+}
+
+type CatalogDiff struct {
+	Before   *DiffSide                 `json:"before"`
+	After    *DiffSide                 `json:"after"`
+	Files    Differences               `json:"files"`
+	Packages []*conda.DependencyChange `json:"packages"`
+}
+
+func ResolveDiffSide(name string) (side *DiffSide, err error) {
+	defer fail.Around(&err)
+
+	if pathlib.IsFile(name) {
+		kind := "file"
+		if strings.HasSuffix(name, ".meta") {
+			kind = "space"
+		}
+		return loadDiffSide(name, kind, name)
+	}
+
+	// exact name, or catalog of current platform wins over other platforms
+	prefix := strings.TrimSuffix(CatalogName(name), common.Platform())
+	candidates := make([]string, 0, 2)
+	for _, catalog := range Catalogs() {
+		if catalog == name || catalog == CatalogName(name) {
+			candidates = []string{catalog}
+			break
+		}
+		if strings.HasPrefix(catalog, prefix) {
+			candidates = append(candidates, catalog)
+		}
+	}
+	if len(candidates) == 1 {
+		fullpath := filepath.Join(common.HololibCatalogLocation(), candidates[0])
+		return loadDiffSide(name, "catalog", fullpath)
+	}
+	fail.On(len(candidates) > 1, "Name %q matches multiple catalogs: %s", name, strings.Join(candidates, ", "))
+
+	spaces := make([]string, 0, 2)
+	for directory, metafile := range Spacemap() {
+		if filepath.Base(directory) == name {
+			spaces = append(spaces, metafile)
+			continue
+		}
+		shadow, err := NewRoot(directory)
+		if err != nil {
+			continue
+		}
+		if shadow.LoadFrom(metafile) == nil && shadow.Space == name {
+			spaces = append(spaces, metafile)
+		}
+	}
+	sort.Strings(spaces)
+	fail.On(len(spaces) > 1, "Name %q matches multiple spaces: %s", name, strings.Join(spaces, ", "))
+	fail.On(len(spaces) == 0, "Name %q does not match any catalog, blueprint, or space.", name)
+	return loadDiffSide(name, "space", spaces[0])
+}
+
+func loadDiffSide(name, kind, source string) (side *DiffSide, err error) {
+	defer fail.Around(&err)
+
+	root, err := NewRoot(".")
+	fail.On(err != nil, "Could not create root for %q, reason: %v", source, err)
+	err = root.LoadFrom(source)
+	fail.On(err != nil, "Could not load %q, reason: %v", source, err)
+	return &DiffSide{
+		Name:      name,
+		Kind:      kind,
+		Blueprint: root.Blueprint,
+		Source:    source,
+		root:      root,
+	}, nil
+}
+
+func Diff(before, after *DiffSide) *CatalogDiff {
+	common.TimelineBegin("holotree diff start")
+	defer common.TimelineEnd()
+	result := &CatalogDiff{
+		Before: before,
+		After:  after,
+		Files:  DiffTrees(before.root.Tree, after.root.Tree),
+	}
+	left := conda.ParseWantedDependencies(before.Dependencies())
+	right := conda.ParseWantedDependencies(after.Dependencies())
+	result.Packages = conda.DependencyChanges(left, right)
+	return result
+}
+
+func DiffTrees(before, after *Dir) Differences {
+	result := make(Differences, 0, 100)
+	result = diffDirs("", before, after, result)
+	sort.SliceStable(result, func(left, right int) bool {
+		return result[left].Path < result[right].Path
+	})
+	return result
+}
+
+func dirEntry(path string, it *Dir) *DiffEntry {
+	return &DiffEntry{
+		Path:    path,
+		Kind:    "dir",
+		Symlink: it.Symlink,
+		Mode:    it.Mode.String(),
+	}
+}
+
+func fileEntry(path string, it *File) *DiffEntry {
+	return &DiffEntry{
+		Path:    path,
+		Kind:    "file",
+		Symlink: it.Symlink,
+		Size:    it.Size,
+		Mode:    it.Mode.String(),
+		Digest:  it.Digest,
+	}
+}
+
+func fileChanged(before, after *File) bool {
+	if before.Symlink != after.Symlink {
+		return true
+	}
+	if before.IsSymlink() {
+		return false
+	}
+	return before.Digest != after.Digest || before.Size != after.Size || before.Mode != after.Mode
+}
+
+func diffDirs(path string, before, after *Dir, result Differences) Differences {
+	empty := newDir("", "", false)
+	if before == nil {
+		before = empty
+	}
+	if after == nil {
+		after = empty
+	}
+	for name, left := range before.Files {
+		fullpath := filepath.Join(path, name)
+		right, ok := after.Files[name]
+		if !ok {
+			result = append(result, &Difference{fullpath, DiffRemoved, fileEntry(fullpath, left), nil})
+			continue
+		}
+		if fileChanged(left, right) {
+			result = append(result, &Difference{fullpath, DiffChanged, fileEntry(fullpath, left), fileEntry(fullpath, right)})
+		}
+	}
+	for name, right := range after.Files {
+		fullpath := filepath.Join(path, name)
+		if _, ok := before.Files[name]; !ok {
+			result = append(result, &Difference{fullpath, DiffAdded, nil, fileEntry(fullpath, right)})
+		}
+	}
+	for name, left := range before.Dirs {
+		fullpath := filepath.Join(path, name)
+		right, ok := after.Dirs[name]
+		switch {
+		case !ok && left.IsSymlink():
+			result = append(result, &Difference{fullpath, DiffRemoved, dirEntry(fullpath, left), nil})
+		case !ok:
+			result = diffDirs(fullpath, left, nil, result)
+		case left.Symlink != right.Symlink:
+			result = append(result, &Difference{fullpath, DiffChanged, dirEntry(fullpath, left), dirEntry(fullpath, right)})
+		case !left.IsSymlink():
+			result = diffDirs(fullpath, left, right, result)
+		}
+	}
+	for name, right := range after.Dirs {
+		fullpath := filepath.Join(path, name)
+		if _, ok := before.Dirs[name]; ok {
+			continue
+		}
+		if right.IsSymlink() {
+			result = append(result, &Difference{fullpath, DiffAdded, nil, dirEntry(fullpath, right)})
+			continue
+		}
+		result = diffDirs(fullpath, nil, right, result)
+	}
+	return result
+}
+
+func (it *DiffEntry) String() string {
+	if len(it.Symlink) > 0 {
+		return fmt.Sprintf("%s -> %s", it.Mode, it.Symlink)
+	}
+	if it.Kind == "dir" {
+		return it.Mode
+	}
+	return fmt.Sprintf("%s %d %s", it.Mode, it.Size, it.Digest)
+}
@@ -0,0 +1,86 @@
+package htfs_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/hamlet"
+	"github.com/robocorp/rcc/htfs"
+)
+
+func tree(files map[string]*htfs.File, dirs map[string]*htfs.Dir) *htfs.Dir {
+	if files == nil {
+		files = make(map[string]*htfs.File)
+	}
+	if dirs == nil {
+		dirs = make(map[string]*htfs.Dir)
+	}
+	return &htfs.Dir{Files: files, Dirs: dirs}
+}
+
+func TestDiffTreesFindsAddedRemovedAndChangedFiles(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	before := tree(map[string]*htfs.File{
+		"same.txt":    {Name: "same.txt", Size: 3, Digest: "aaa"},
+		"changed.txt": {Name: "changed.txt", Size: 3, Digest: "bbb"},
+		"removed.txt": {Name: "removed.txt", Size: 3, Digest: "ccc"},
+	}, map[string]*htfs.Dir{
+		"gone": tree(map[string]*htfs.File{"inner.txt": {Name: "inner.txt", Digest: "ddd"}}, nil),
+	})
+	after := tree(map[string]*htfs.File{
+		"same.txt":    {Name: "same.txt", Size: 3, Digest: "aaa"},
+		"changed.txt": {Name: "changed.txt", Size: 4, Digest: "eee"},
+		"added.txt":   {Name: "added.txt", Size: 3, Digest: "fff"},
+	}, map[string]*htfs.Dir{
+		"link": {Name: "link", Symlink: "gone", Dirs: map[string]*htfs.Dir{}, Files: map[string]*htfs.File{}},
+	})
+
+	delta := htfs.DiffTrees(before, after)
+	wont.Nil(delta)
+	must.Equal(5, len(delta))
+	must.Equal(2, delta.Count(htfs.DiffAdded))
+	must.Equal(2, delta.Count(htfs.DiffRemoved))
+	must.Equal(1, delta.Count(htfs.DiffChanged))
+
+	must.Equal("added.txt", delta[0].Path)
+	must.Equal("changed.txt", delta[1].Path)
+	must.Equal("eee", delta[1].After.Digest)
+	must.Equal("gone/inner.txt", delta[2].Path)
+	must.Equal("link", delta[3].Path)
+	must.Equal("gone", delta[3].After.Symlink)
+	must.Equal("removed.txt", delta[4].Path)
+
+	must.Equal(0, len(htfs.DiffTrees(after, after)))
+}
+
+func TestDiffSidePrefersCatalogOfCurrentPlatform(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	t.Setenv("ROBOCORP_HOME", t.TempDir())
+	must.Nil(os.MkdirAll(common.HololibCatalogLocation(), 0o755))
+	blueprint := "0123456789abcdef"
+	root, err := htfs.NewRoot(".")
+	must.Nil(err)
+	root.Blueprint = blueprint
+	current := filepath.Join(common.HololibCatalogLocation(), htfs.CatalogName(blueprint))
+	other := strings.TrimSuffix(current, common.Platform()) + "plan9_mips"
+	must.Nil(root.SaveAs(other))
+
+	side, err := htfs.ResolveDiffSide(blueprint)
+	must.Nil(err)
+	must.Equal(other, side.Source)
+
+	must.Nil(root.SaveAs(current))
+	side, err = htfs.ResolveDiffSide(blueprint)
+	must.Nil(err)
+	must.Equal(current, side.Source)
+
+	must.Nil(os.Remove(current))
+	must.Nil(root.SaveAs(strings.TrimSuffix(current, common.Platform()) + "aix_ppc64"))
+	_, err = htfs.ResolveDiffSide(blueprint)
+	wont.Nil(err)
+}
@@ -1,8 +1,8 @@
 package htfs
 
 import (
+	"bufio"
 	"bytes"
-	"compress/gzip"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -51,8 +51,16 @@ type Root struct {
 	Platform   string `json:"platform"`
 	Blueprint  string `json:"blueprint"`
 	Lifted     bool   `json:"lifted"`
+	Pool       string `json:"pool,omitempty"`
+	PoolSize   int    `json:"pool-size,omitempty"`
+	Protected  bool   `json:"protected,omitempty"`
+	Bytecode   string `json:"bytecode,omitempty"`
+	Adopted    string `json:"adopted,omitempty"`
 	Tree       *Dir   `json:"tree"`
 	source     string
+	relocation *relocation
+	summary    *TreeStats
+	legacy     bool
 }
 
 func NewRoot(path string) (*Root, error) {
@@ -73,6 +81,10 @@ func NewRoot(path string) (*Root, error) {
 }
 
 func (it *Root) Show(filename string) ([]byte, error) {
+	err := it.complete()
+	if err != nil {
+		return nil, err
+	}
 	return it.Tree.Show(filepath.SplitList(filename), filename)
 }
 
@@ -113,18 +125,52 @@ func (it *Root) Relocate(target string) error {
 	return nil
 }
 
+func (it *Root) RelocateAnywhere(target string) error {
+	if it.Relocate(target) == nil {
+		return nil
+	}
+	if !filepath.IsAbs(target) {
+		return fmt.Errorf("Target must be absolute path: %q.", target)
+	}
+	it.relocation = newRelocation(it.Path, target)
+	it.Path = target
+	it.Identity = filepath.Base(target)
+	return nil
+}
+
+func (it *Root) RelocateAdopted(target string) error {
+	if !filepath.IsAbs(target) {
+		return fmt.Errorf("Target must be absolute path: %q.", target)
+	}
+	it.relocation = newAdoptedRelocation(it.Adopted, target)
+	it.Path = target
+	it.Identity = filepath.Base(target)
+	return nil
+}
+
+func (it *Root) RelocationReport() error {
+	if it.relocation == nil {
+		return nil
+	}
+	return it.relocation.Report()
+}
+
 func (it *Root) Lift() error {
 	if it.Lifted {
 		return nil
 	}
 	it.Lifted = true
-	return it.Tree.Lift(it.Path)
+	return it.Tree.lift(it.Path, len(it.Bytecode) > 0)
 }
 
 func (it *Root) Treetop(task Treetop) error {
+	err := it.complete()
+	if err != nil {
+		return err
+	}
 	common.TimelineBegin("holotree treetop sync start")
 	defer common.TimelineEnd()
-	err := task(it.Path, it.Tree)
+	err = task(it.Path, it.Tree)
 	if err != nil {
 		return err
 	}
@@ -132,6 +178,9 @@ func (it *Root) Treetop(task Treetop) error {
 }
 
 func (it *Root) Stats() (*TreeStats, error) {
+	if it.summary != nil {
+		return it.summary, nil
+	}
 	task, stats := CalculateTreeStats()
 	err := it.AllDirs(task)
 	if err != nil {
@@ -141,6 +190,10 @@ func (it *Root) Stats() (*TreeStats, error) {
 }
 
 func (it *Root) AllDirs(task Dirtask) error {
+	err := it.complete()
+	if err != nil {
+		return err
+	}
 	common.TimelineBegin("holotree dirs sync start")
 	defer common.TimelineEnd()
 	it.Tree.AllDirs(it.Path, task)
@@ -148,6 +201,10 @@ func (it *Root) AllDirs(task Dirtask) error {
 }
 
 func (it *Root) AllFiles(task Filetask) error {
+	err := it.complete()
+	if err != nil {
+		return err
+	}
 	common.TimelineBegin("holotree files sync start")
 	defer common.TimelineEnd()
 	it.Tree.AllFiles(it.Path, task)
@@ -159,48 +216,28 @@ func (it *Root) AsJson() ([]byte, error) {
 }
 
 func (it *Root) SaveAs(filename string) error {
-	content, err := it.AsJson()
-	if err != nil {
-		return err
-	}
 	sink, err := os.Create(filename)
 	if err != nil {
 		return err
 	}
 	defer sink.Close()
 	defer sink.Sync()
-	writer, err := gzip.NewWriterLevel(sink, gzip.BestSpeed)
-	if err != nil {
-		return err
-	}
-	defer writer.Close()
-	_, err = writer.Write(content)
-	if err != nil {
-		return err
-	}
-	return nil
+	return it.writeCatalog(sink)
 }
 
 func (it *Root) ReadFrom(source io.Reader) error {
-	decoder := json.NewDecoder(source)
+	buffered := bufio.NewReader(source)
+	if isBinaryCatalog(buffered) {
+		return it.readCatalog(buffered, false)
+	}
+	decoder := json.NewDecoder(buffered)
 	return decoder.Decode(&it)
 }
 
 func (it *Root) LoadFrom(filename string) error {
 	common.TimelineBegin("holotree load %q", filename)
 	defer common.TimelineEnd()
-	source, err := os.Open(filename)
-	if err != nil {
-		return err
-	}
-	defer source.Close()
-	reader, err := gzip.NewReader(source)
-	if err != nil {
-		return err
-	}
-	it.source = filename
-	defer reader.Close()
-	return it.ReadFrom(reader)
+	return it.loadCatalog(filename, false)
 }
 
 type Dir struct {
@@ -212,10 +249,13 @@ type Dir struct {
 	Shadow  bool             `json:"shadow,omitempty"`
 }
 
-func showFile(filename string) (content []byte, err error) {
+func showFile(filename, digest string) (content []byte, err error) {
 	defer fail.Around(&err)
 
-	reader, closer, err := gzDelegateOpen(filename, true)
+	reader, closer, err := codecDelegateOpen(filename, true)
+	if err != nil && IsPacked(digest) {
+		reader, closer, err = packedDelegateOpen(digest, true)
+	}
 	fail.On(err != nil, "Failed to open %q, reason: %v", filename, err)
 	defer closer()
 
@@ -239,7 +279,7 @@ func (it *Dir) Show(path []string, fullpath string) ([]byte, error) {
 	}
 	location := guessLocation(file.Digest)
 	rawfile := filepath.Join(common.HololibLibraryLocation(), location)
-	return showFile(rawfile)
+	return showFile(rawfile, file.Digest)
 }
 
 func (it *Dir) IsSymlink() bool {
@@ -265,7 +305,18 @@ func (it *Dir) AllFiles(path string, task Filetask) {
 	}
 }
 
+func killed(name string, bytecode bool) bool {
+	if bytecode && (name == "__pycache__" || filepath.Ext(name) == ".pyc") {
+		return false
+	}
+	return killfile[name] || killfile[filepath.Ext(name)]
+}
+
 func (it *Dir) Lift(path string) error {
+	return it.lift(path, false)
+}
+
+func (it *Dir) lift(path string, bytecode bool) error {
 	stat, err := os.Stat(path)
 	if err != nil {
 		return err
@@ -277,7 +328,7 @@ func (it *Dir) Lift(path string) error {
 	}
 	shadow := it.Shadow || it.IsSymlink()
 	for _, part := range content {
-		if killfile[part.Name()] || killfile[filepath.Ext(part.Name())] {
+		if killed(part.Name(), bytecode) {
 			continue
 		}
 		fullpath := filepath.Join(path, part.Name())
@@ -294,7 +345,7 @@ func (it *Dir) Lift(path string) error {
 		it.Files[part.Name()] = newFile(info, symlink)
 	}
 	for name, dir := range it.Dirs {
-		err = dir.Lift(filepath.Join(path, name))
+		err = dir.lift(filepath.Join(path, name), bytecode)
 		if err != nil {
 			return err
 		}
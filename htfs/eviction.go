@@ -0,0 +1,260 @@
+package htfs
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/fail"
+	"github.com/robocorp/rcc/pathlib"
+	"github.com/robocorp/rcc/settings"
+)
+
+const (
+	evictionGrace = 24 * time.Hour
+)
+
+type Eviction struct {
+	Limit     uint64        `json:"limit"`
+	Before    uint64        `json:"before"`
+	After     uint64        `json:"after"`
+	Dryrun    bool          `json:"dryrun"`
+	Evicted   []string      `json:"evicted"`
+	Protected []string      `json:"protected"`
+	Garbage   *GarbageStats `json:"garbage,omitempty"`
+}
+
+func (it *Eviction) Exceeded() bool {
+	return it.After > it.Limit
+}
+
+func LibraryLimit() uint64 {
+	return uint64(settings.Global.HolotreeMaxLibrarySize()) * 1024 * 1024
+}
+
+func folderSize(location string) uint64 {
+	total := uint64(0)
+	filepath.WalkDir(location, func(fullpath string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err == nil {
+			total += uint64(info.Size())
+		}
+		return nil
+	})
+	return total
+}
+
+// LibrarySize is disk usage of hololib objects, including hardlink copies
+// and pack files, but not catalogs themselves.
+func LibrarySize() uint64 {
+	total := folderSize(common.HololibLibraryLocation())
+	total += folderSize(common.HololibLinksLocation())
+	total += folderSize(common.HololibPackLocation())
+	return total
+}
+
+func objectSize(library MutableLibrary, digest string) uint64 {
+	info, err := os.Stat(library.ExactLocation(digest))
+	if err != nil {
+		_, _, size, _ := packs.find(digest)
+		return uint64(size)
+	}
+	return uint64(info.Size())
+}
+
+func catalogLastUsed(catalog *Root) time.Time {
+	candidates := pathlib.Glob(common.HololibUsageLocation(), catalog.Blueprint+".*")
+	for at, candidate := range candidates {
+		candidates[at] = filepath.Join(common.HololibUsageLocation(), candidate)
+	}
+	return latest(append(candidates, catalog.Source())...)
+}
+
+// protectedBlueprints are blueprints of spaces that are leased, in use, or
+// were restored within eviction grace period.
+func protectedBlueprints() map[string]bool {
+	result := make(map[string]bool)
+	for _, space := range Spaces() {
+		recent := time.Since(SpaceLifecycle(space).LastUsed) < evictionGrace
+		if recent || spaceBusy(space.Path) {
+			result[space.Blueprint] = true
+		}
+	}
+	return result
+}
+
+type evictable struct {
+	catalog  *Root
+	digests  map[string]bool
+	lastUsed time.Time
+}
+
+func newEvictable(catalog *Root) *evictable {
+	digests := make(map[string]bool)
+	DigestMarker(digests)(catalog.Path, catalog.Tree)
+	return &evictable{
+		catalog: catalog,
+		digests: digests,
+	}
+}
+
+// selectEvictions picks least recently used candidates until estimated size
+// is within limit; objects are freed when their last reference goes away.
+func selectEvictions(candidates []*evictable, references map[string]int, sizeOf func(string) uint64, current, limit uint64) ([]*evictable, uint64) {
+	sort.SliceStable(candidates, func(left, right int) bool {
+		return candidates[left].lastUsed.Before(candidates[right].lastUsed)
+	})
+	selected := make([]*evictable, 0, len(candidates))
+	for _, candidate := range candidates {
+		if current <= limit {
+			break
+		}
+		for digest := range candidate.digests {
+			references[digest] -= 1
+			if references[digest] == 0 {
+				current -= min(current, sizeOf(digest))
+			}
+		}
+		selected = append(selected, candidate)
+	}
+	return selected, current
+}
+
+func evictLibrary(limit uint64, dryrun bool) (result *Eviction, err error) {
+	defer fail.Around(&err)
+
+	result = &Eviction{
+		Limit:     limit,
+		Before:    LibrarySize(),
+		Dryrun:    dryrun,
+		Evicted:   []string{},
+		Protected: []string{},
+	}
+	result.After = result.Before
+	if result.Before <= limit {
+		return result, nil
+	}
+
+	library, err := New()
+	fail.On(err != nil, "%v", err)
+	catalogs, roots := LoadCatalogs()
+	err = strictCatalogs(catalogs, roots)
+	fail.On(err != nil, "%v", err)
+	protected := protectedBlueprints()
+	references := make(map[string]int)
+	everything := make([]*evictable, 0, len(roots))
+	candidates := make([]*evictable, 0, len(roots))
+	for _, root := range roots {
+		entry := newEvictable(root)
+		everything = append(everything, entry)
+		for digest := range entry.digests {
+			references[digest] += 1
+		}
+		if protected[root.Blueprint] {
+			result.Protected = append(result.Protected, filepath.Base(root.Source()))
+			continue
+		}
+		entry.lastUsed = catalogLastUsed(root)
+		candidates = append(candidates, entry)
+	}
+	sizeOf := func(digest string) uint64 {
+		return objectSize(library, digest)
+	}
+	selected, estimate := selectEvictions(candidates, references, sizeOf, result.Before, limit)
+	result.After = estimate
+	evicted := make(map[*Root]bool)
+	for _, entry := range selected {
+		evicted[entry.catalog] = true
+		result.Evicted = append(result.Evicted, filepath.Base(entry.catalog.Source()))
+		common.Debug("Evicting catalog %q, last used %s.", entry.catalog.Source(), entry.lastUsed.Format(time.RFC3339))
+	}
+	if dryrun || len(evicted) == 0 {
+		return result, nil
+	}
+
+	marked := make(map[string]bool)
+	for _, entry := range everything {
+		if evicted[entry.catalog] {
+			err = TryRemove("catalog", entry.catalog.Source())
+			fail.On(err != nil, "%v", err)
+			continue
+		}
+		for digest := range entry.digests {
+			marked[digest] = true
+		}
+	}
+	_, err = markLegacyDigests(marked)
+	fail.On(err != nil, "%v", err)
+	result.Garbage, err = SweepLibrary(marked, false)
+	fail.On(err != nil, "%v", err)
+	result.Garbage.Catalogs = uint64(len(roots) - len(evicted))
+	result.After = LibrarySize()
+	return result, nil
+}
+
+// EvictLibrary removes least recently used catalogs, and objects only they
+// refer to, until hololib fits into given size limit.
+func EvictLibrary(limit uint64, dryrun bool) (result *Eviction, err error) {
+	defer fail.Around(&err)
+
+	common.TimelineBegin("holotree evict start")
+	defer common.TimelineEnd()
+
+	completed := pathlib.LockWaitMessage("Serialized holotree eviction [holotree lock]")
+	locker, err := pathlib.Locker(common.HolotreeLock(), 30000)
+	completed()
+	fail.On(err != nil, "Could not get lock for holotree. Quiting.")
+	defer locker.Release()
+
+	return evictLibrary(limit, dryrun)
+}
+
+var (
+	evictionSuspended bool
+)
+
+// SuspendEviction keeps opportunistic eviction from running, so that command
+// building several environments does not evict ones it built earlier. Returned
+// function lifts suspension and runs eviction once.
+func SuspendEviction() func() {
+	evictionSuspended = true
+	return func() {
+		evictionSuspended = false
+		EvictOpportunistically()
+	}
+}
+
+// EvictOpportunistically applies settings.yaml hololib size limit, but gives
+// up instead of waiting, when holotree is busy.
+func EvictOpportunistically() {
+	limit := LibraryLimit()
+	if limit == 0 || common.Liveonly || evictionSuspended {
+		return
+	}
+	locker, ok := pathlib.TryLocker(common.HolotreeLock())
+	if !ok {
+		common.Debug("Holotree is busy, skipping opportunistic hololib eviction.")
+		return
+	}
+	defer locker.Release()
+
+	common.TimelineBegin("holotree opportunistic evict start")
+	defer common.TimelineEnd()
+	result, err := evictLibrary(limit, false)
+	if err != nil {
+		common.Debug("Opportunistic hololib eviction failed, reason: %v", err)
+		return
+	}
+	if len(result.Evicted) > 0 {
+		common.Log("Evicted %d hololib catalogs, size went from %dM to %dM [limit %dM].", len(result.Evicted), result.Before>>20, result.After>>20, limit>>20)
+	}
+	if result.Exceeded() {
+		common.Debug("Hololib size %d is still above limit %d.", result.After, limit)
+	}
+}
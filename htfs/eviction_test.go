@@ -0,0 +1,59 @@
+package htfs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robocorp/rcc/hamlet"
+)
+
+func evictableFixture(name string, age time.Duration, digests ...string) *evictable {
+	result := &evictable{
+		catalog:  &Root{Blueprint: name},
+		digests:  make(map[string]bool),
+		lastUsed: time.Now().Add(-age),
+	}
+	for _, digest := range digests {
+		result.digests[digest] = true
+	}
+	return result
+}
+
+func TestSelectEvictionsFreesOnlyUnsharedObjectsInLruOrder(t *testing.T) {
+	must, _ := hamlet.Specifications(t)
+
+	sizes := map[string]uint64{"shared": 100, "old": 30, "older": 20, "new": 50}
+	sizeOf := func(digest string) uint64 {
+		return sizes[digest]
+	}
+	counted := func(entries ...*evictable) map[string]int {
+		result := make(map[string]int)
+		for _, entry := range entries {
+			for digest := range entry.digests {
+				result[digest] += 1
+			}
+		}
+		return result
+	}
+
+	oldest := evictableFixture("oldest", 3*time.Hour, "shared", "older")
+	old := evictableFixture("old", 2*time.Hour, "shared", "old")
+	fresh := evictableFixture("fresh", time.Hour, "shared", "new")
+	references := counted(oldest, old, fresh)
+
+	selected, estimate := selectEvictions([]*evictable{fresh, old, oldest}, references, sizeOf, 200, 180)
+	must.Equal(1, len(selected))
+	must.Equal("oldest", selected[0].catalog.Blueprint)
+	must.Equal(uint64(180), estimate)
+
+	references = counted(oldest, old, fresh)
+	selected, estimate = selectEvictions([]*evictable{fresh, old, oldest}, references, sizeOf, 200, 100)
+	must.Equal(3, len(selected))
+	must.Equal("fresh", selected[2].catalog.Blueprint)
+	must.Equal(uint64(0), estimate)
+
+	references = counted(oldest, old, fresh)
+	selected, estimate = selectEvictions([]*evictable{old, oldest}, references, sizeOf, 200, 100)
+	must.Equal(2, len(selected))
+	must.Equal(uint64(150), estimate)
+}
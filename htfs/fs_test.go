@@ -3,6 +3,7 @@ package htfs_test
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/robocorp/rcc/common"
@@ -56,3 +57,40 @@ func TestZipLibrary(t *testing.T) {
 	wont.Nil(sut)
 	must.True(sut.HasBlueprint(blueprint))
 }
+
+func TestBlueprintHasResolvedPrecompilePolicy(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	_, blueprint, err := htfs.ComposeFinalBlueprint([]string{"testdata/simple.yaml"}, "")
+	must.Nil(err)
+	wont.True(strings.Contains(string(blueprint), "rccPrecompile"))
+
+	condafile := filepath.Join(t.TempDir(), "conda.yaml")
+	must.Nil(os.WriteFile(condafile, []byte("dependencies:\n- python=3.10\nrccPrecompile: Checked-Hash\n"), 0o644))
+	_, blueprint, err = htfs.ComposeFinalBlueprint([]string{condafile}, "")
+	must.Nil(err)
+	must.True(strings.Contains(string(blueprint), "rccPrecompile: checked-hash"))
+}
+
+func TestLiftKeepsBytecodeOnlyWhenAsked(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	stage := filepath.Join(t.TempDir(), "stage")
+	must.Nil(os.MkdirAll(filepath.Join(stage, "lib", "__pycache__"), 0o755))
+	must.Nil(os.WriteFile(filepath.Join(stage, "lib", "module.py"), []byte("pass"), 0o644))
+	must.Nil(os.WriteFile(filepath.Join(stage, "lib", "__pycache__", "module.cpython-310.pyc"), []byte("pyc"), 0o644))
+
+	plain, err := htfs.NewRoot(stage)
+	must.Nil(err)
+	must.Nil(plain.Lift())
+	_, ok := plain.Tree.Dirs["lib"].Dirs["__pycache__"]
+	wont.True(ok)
+
+	compiled, err := htfs.NewRoot(stage)
+	must.Nil(err)
+	compiled.Bytecode = "unchecked-hash"
+	must.Nil(compiled.Lift())
+	cache, ok := compiled.Tree.Dirs["lib"].Dirs["__pycache__"]
+	must.True(ok)
+	must.Equal(1, len(cache.Files))
+}
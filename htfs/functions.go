@@ -1,7 +1,6 @@
 package htfs
 
 import (
-	"compress/gzip"
 	"crypto/sha256"
 	"fmt"
 	"io"
@@ -22,8 +21,7 @@ import (
 
 func JustFileExistCheck(library MutableLibrary, path, name, digest string) anywork.Work {
 	return func() {
-		location := library.ExactLocation(digest)
-		if !pathlib.IsFile(location) {
+		if !HasObject(library, digest) {
 			fullpath := filepath.Join(path, name)
 			panic(fmt.Errorf("Content for %q [%s] is missing!", fullpath, digest))
 		}
@@ -108,12 +106,13 @@ func CheckHasher(known map[string]map[string]bool) Filetask {
 			defer source.Close()
 
 			var reader io.ReadCloser
-			reader, err = gzip.NewReader(source)
+			reader, err = Decompressed(source)
 			if err != nil {
 				_, err = source.Seek(0, 0)
 				fail.On(err != nil, "Failed to seek %q -> %v", fullpath, err)
 				reader = source
 			}
+			defer reader.Close()
 			digest := sha256.New()
 			_, err = io.Copy(digest, reader)
 			if err != nil {
@@ -200,6 +199,10 @@ func ScheduleLifters(library MutableLibrary, stats *stats) Treetop {
 				continue
 			}
 			seen[file.Digest] = true
+			if IsPacked(file.Digest) {
+				stats.Dirty(false)
+				continue
+			}
 			directory := library.Location(file.Digest)
 			if !seen[directory] && !pathlib.IsDir(directory) {
 				pathlib.MakeSharedDir(directory)
@@ -237,6 +240,9 @@ func TryRemoveAll(context, target string) (err error) {
 		if err == nil {
 			return nil
 		}
+		if os.IsPermission(err) {
+			liftProtection(target)
+		}
 	}
 	return fmt.Errorf("RemoveAll failure [%s, %s, %s], reason: %s", context, common.ControllerIdentity(), common.HolotreeSpace, err)
 }
@@ -279,7 +285,7 @@ func LiftFile(sourcename, sinkname string) anywork.Work {
 		anywork.OnErrPanicCloseAll(err)
 
 		defer sink.Close()
-		writer, err := gzip.NewWriterLevel(sink, gzip.BestSpeed)
+		writer, err := ObjectCodec().Writer(sink)
 		anywork.OnErrPanicCloseAll(err, sink)
 
 		_, err = io.Copy(writer, source)
@@ -302,6 +308,9 @@ func DropFile(library Library, digest, sinkname string, details *File, rewrite [
 			anywork.OnErrPanicCloseAll(restoreSymlink(details.Symlink, sinkname))
 			return
 		}
+		if linkFile(library, details, sinkname, rewrite) {
+			return
+		}
 		reader, closer, err := library.Open(digest)
 		anywork.OnErrPanicCloseAll(err)
 
@@ -397,7 +406,15 @@ func restoreSymlink(source, target string) error {
 	return os.Symlink(source, target)
 }
 
+func dropFile(library Library, fs *Root, sinkname string, details *File) anywork.Work {
+	if fs.relocation != nil && !details.IsSymlink() && len(details.Rewrite) > 0 {
+		return RelocateFile(library, fs.relocation, details.Digest, sinkname, details)
+	}
+	return DropFile(library, details.Digest, sinkname, details, fs.Rewrite())
+}
+
 func RestoreDirectory(library Library, fs *Root, current map[string]string, stats *stats) Dirtask {
+	hardlinks := linkingLibrary(library) && RestoreMode() == RestoreHardlink
 	return func(path string, it *Dir) anywork.Work {
 		return func() {
 			if it.Shadow {
@@ -443,10 +460,13 @@ func RestoreDirectory(library Library, fs *Root, current map[string]string, stat
 				info, err := part.Info()
 				anywork.OnErrPanicCloseAll(err)
 				ok = golden && found.Match(info)
+				if ok && hardlinks && linkable(found) {
+					ok = isLinkedCorrectly(found, info)
+				}
 				stats.Dirty(!ok)
 				if !ok {
 					common.Trace("* Holotree: update changed file    %q", directpath)
-					anywork.Backlog(DropFile(library, found.Digest, directpath, found, fs.Rewrite()))
+					anywork.Backlog(dropFile(library, fs, directpath, found))
 				}
 			}
 			for name, found := range it.Files {
@@ -455,7 +475,7 @@ func RestoreDirectory(library Library, fs *Root, current map[string]string, stat
 				if !seen {
 					stats.Dirty(true)
 					common.Trace("* Holotree: add missing file       %q", directpath)
-					anywork.Backlog(DropFile(library, found.Digest, directpath, found, fs.Rewrite()))
+					anywork.Backlog(dropFile(library, fs, directpath, found))
 				}
 			}
 		}
@@ -465,6 +485,7 @@ func RestoreDirectory(library Library, fs *Root, current map[string]string, stat
 type Zipper interface {
 	Ignore(relativepath string)
 	Add(fullpath, relativepath string) error
+	AddFrom(source io.Reader, relativepath string) error
 }
 
 func ZipIgnore(library MutableLibrary, fs *Root, sink Zipper) Treetop {
@@ -499,7 +520,11 @@ func ZipRoot(library MutableLibrary, fs *Root, sink Zipper) Treetop {
 			location := library.ExactLocation(file.Digest)
 			relative, err := filepath.Rel(baseline, location)
 			fail.On(err != nil, "Relative path error: %s -> %s -> %v", baseline, location, err)
-			err = sink.Add(location, relative)
+			if !pathlib.IsFile(location) && IsPacked(file.Digest) {
+				err = zipPacked(file.Digest, relative, sink)
+			} else {
+				err = sink.Add(location, relative)
+			}
 			fail.On(err != nil, "%v", err)
 		}
 		for name, subdir := range it.Dirs {
@@ -555,13 +580,24 @@ func DigestLoader(root *Root, at int, slots []map[string]string) anywork.Work {
 }
 
 func LoadCatalogs() ([]string, []*Root) {
+	return loadCatalogs(false)
+}
+
+func LoadCatalogHeaders() ([]string, []*Root) {
+	return loadCatalogs(true)
+}
+
+func loadCatalogs(headerOnly bool) ([]string, []*Root) {
+	return loadCatalogsFrom(Catalogs(), headerOnly)
+}
+
+func loadCatalogsFrom(catalogs []string, headerOnly bool) ([]string, []*Root) {
 	common.TimelineBegin("catalog load start")
 	defer common.TimelineEnd()
-	catalogs := Catalogs()
 	roots := make([]*Root, len(catalogs))
 	for at, catalog := range catalogs {
 		fullpath := filepath.Join(common.HololibCatalogLocation(), catalog)
-		anywork.Backlog(CatalogLoader(fullpath, at, roots))
+		anywork.Backlog(catalogLoader(fullpath, at, roots, headerOnly))
 		catalogs[at] = fullpath
 	}
 	runtime.Gosched()
@@ -570,7 +606,7 @@ func LoadCatalogs() ([]string, []*Root) {
 }
 
 func BaseFolders() []string {
-	_, roots := LoadCatalogs()
+	_, roots := LoadCatalogHeaders()
 	folders := make(map[string]bool)
 	result := []string{}
 	for _, root := range roots {
@@ -584,13 +620,17 @@ func BaseFolders() []string {
 }
 
 func CatalogLoader(catalog string, at int, roots []*Root) anywork.Work {
+	return catalogLoader(catalog, at, roots, false)
+}
+
+func catalogLoader(catalog string, at int, roots []*Root, headerOnly bool) anywork.Work {
 	return func() {
 		tempdir := filepath.Join(common.RobocorpTemp(), "shadow")
 		shadow, err := NewRoot(tempdir)
 		if err != nil {
 			panic(fmt.Sprintf("Temp dir %q, reason: %v", tempdir, err))
 		}
-		err = shadow.LoadFrom(catalog)
+		err = shadow.loadCatalog(catalog, headerOnly)
 		if err != nil {
 			panic(fmt.Sprintf("Load %q, reason: %v", catalog, err))
 		}
@@ -0,0 +1,250 @@
+package htfs
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/robocorp/rcc/anywork"
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/fail"
+	"github.com/robocorp/rcc/pathlib"
+)
+
+type GarbageStats struct {
+	sync.Mutex
+	Catalogs  uint64
+	Objects   uint64
+	Garbage   uint64
+	Bytes     uint64
+	Reclaimed uint64
+	Dryrun    bool
+}
+
+func (it *GarbageStats) seen(size int64, garbage bool) {
+	it.Lock()
+	defer it.Unlock()
+
+	it.Objects += 1
+	it.Bytes += uint64(size)
+	if garbage {
+		it.Garbage += 1
+		it.Reclaimed += uint64(size)
+	}
+}
+
+// strictCatalogs fails if any catalog could not be loaded, since destructive
+// operations cannot trust partial view of what is referenced.
+func strictCatalogs(catalogs []string, roots []*Root) (err error) {
+	defer fail.Around(&err)
+
+	for at, root := range roots {
+		fail.On(root == nil, "Catalog %q could not be loaded.", catalogs[at])
+	}
+	return nil
+}
+
+func DigestMarker(marked map[string]bool) Treetop {
+	var tool Treetop
+	tool = func(path string, it *Dir) error {
+		for name, subdir := range it.Dirs {
+			tool(filepath.Join(path, name), subdir)
+		}
+		for _, file := range it.Files {
+			marked[file.Digest] = true
+		}
+		return nil
+	}
+	return tool
+}
+
+func MarkReferencedDigests() (marked map[string]bool, count int, err error) {
+	defer fail.Around(&err)
+
+	catalogs, roots := LoadCatalogs()
+	err = strictCatalogs(catalogs, roots)
+	fail.On(err != nil, "%v", err)
+	marked = make(map[string]bool)
+	common.TimelineBegin("holotree gc mark start")
+	defer common.TimelineEnd()
+	for _, root := range roots {
+		err = DigestMarker(marked)(root.Path, root.Tree)
+		fail.On(err != nil, "Marking %q failed, reason: %v", root.Source(), err)
+	}
+	legacy, err := markLegacyDigests(marked)
+	fail.On(err != nil, "%v", err)
+	return marked, len(roots) + legacy, nil
+}
+
+// markLegacyDigests keeps objects of legacy catalogs, since older rcc versions
+// sharing same hololib still use them.
+func markLegacyDigests(marked map[string]bool) (count int, err error) {
+	defer fail.Around(&err)
+
+	catalogs, roots := loadCatalogsFrom(LegacyCatalogs(), false)
+	err = strictCatalogs(catalogs, roots)
+	fail.On(err != nil, "%v", err)
+	for _, root := range roots {
+		err = DigestMarker(marked)(root.Path, root.Tree)
+		fail.On(err != nil, "Marking %q failed, reason: %v", root.Source(), err)
+	}
+	return len(roots), nil
+}
+
+func linkDigest(name string) string {
+	return strings.SplitN(name, ".", 2)[0]
+}
+
+func exactDigest(name string) string {
+	return name
+}
+
+func sweepFolder(location string, marked map[string]bool, digestOf func(string) string, stats *GarbageStats) (err error) {
+	defer fail.Around(&err)
+
+	if !pathlib.IsDir(location) {
+		return nil
+	}
+	err = filepath.WalkDir(location, func(fullpath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		digest := digestOf(entry.Name())
+		garbage := !marked[digest] || strings.Contains(entry.Name(), ".part")
+		stats.seen(info.Size(), garbage)
+		if !garbage {
+			return nil
+		}
+		common.Trace("* Holotree gc: unreferenced %s [%d bytes]", entry.Name(), info.Size())
+		if !stats.Dryrun {
+			anywork.Backlog(RemoveFile(fullpath))
+		}
+		return nil
+	})
+	fail.On(err != nil, "Walking %q failed, reason: %v", location, err)
+	err = anywork.Sync()
+	fail.On(err != nil, "Removing unreferenced objects failed, reason: %v", err)
+	if !stats.Dryrun {
+		err = pathlib.RemoveEmptyDirectores(location)
+		fail.On(err != nil, "%v", err)
+	}
+	return nil
+}
+
+func readPackEntries(index *packIndex, digests []string) (contents [][]byte, err error) {
+	defer fail.Around(&err)
+
+	source, err := os.Open(index.packfile)
+	fail.On(err != nil, "Failed to open %q -> %v", index.packfile, err)
+	defer source.Close()
+	contents = make([][]byte, 0, len(digests))
+	for _, digest := range digests {
+		raw, _ := hex.DecodeString(digest)
+		offset, size, ok := index.lookup(raw)
+		fail.On(!ok, "Object %q is not in pack %q.", digest, index.packfile)
+		content, err := io.ReadAll(io.NewSectionReader(source, offset, size))
+		fail.On(err != nil, "Could not read packed %q, reason: %v", digest, err)
+		contents = append(contents, content)
+	}
+	return contents, nil
+}
+
+func rewritePack(index *packIndex, kept []string) (err error) {
+	defer fail.Around(&err)
+
+	contents, err := readPackEntries(index, kept)
+	fail.On(err != nil, "%v", err)
+	writer, err := newPackWriter(common.HololibPackLocation())
+	fail.On(err != nil, "%v", err)
+	for at, digest := range kept {
+		err = writer.append(digest, contents[at])
+		if err != nil {
+			writer.abort()
+			fail.On(true, "Could not append %s to pack, reason: %v", digest, err)
+		}
+	}
+	return writer.finish()
+}
+
+// sweepPacks drops packs which have no referenced objects left, and rewrites
+// packs which have some, so that only referenced objects remain packed.
+func sweepPacks(marked map[string]bool, stats *GarbageStats) (err error) {
+	defer fail.Around(&err)
+
+	packs.forget()
+	defer packs.forget()
+	for _, index := range packs.current() {
+		kept := make([]string, 0, index.count())
+		for at := 0; at < index.count(); at++ {
+			digest := fmt.Sprintf("%02x", index.digestAt(at))
+			_, size, _ := index.lookup(index.digestAt(at))
+			garbage := !marked[digest]
+			stats.seen(size, garbage)
+			if garbage {
+				common.Trace("* Holotree gc: unreferenced packed %s [%d bytes]", digest, size)
+				continue
+			}
+			kept = append(kept, digest)
+		}
+		if stats.Dryrun || len(kept) == index.count() {
+			continue
+		}
+		if len(kept) > 0 {
+			err = rewritePack(index, kept)
+			fail.On(err != nil, "Rewriting pack %q failed, reason: %v", index.packfile, err)
+		}
+		err = TryRemove("packindex", strings.TrimSuffix(index.packfile, ".pack")+".idx")
+		fail.On(err != nil, "%v", err)
+		err = TryRemove("packfile", index.packfile)
+		fail.On(err != nil, "%v", err)
+	}
+	return nil
+}
+
+func SweepLibrary(marked map[string]bool, dryrun bool) (stats *GarbageStats, err error) {
+	defer fail.Around(&err)
+
+	common.TimelineBegin("holotree gc sweep start")
+	defer common.TimelineEnd()
+	stats = &GarbageStats{Dryrun: dryrun}
+	err = sweepFolder(common.HololibLibraryLocation(), marked, exactDigest, stats)
+	fail.On(err != nil, "%v", err)
+	err = sweepFolder(common.HololibLinksLocation(), marked, linkDigest, stats)
+	fail.On(err != nil, "%v", err)
+	err = sweepPacks(marked, stats)
+	fail.On(err != nil, "%v", err)
+	return stats, nil
+}
+
+func CollectGarbage(dryrun bool) (stats *GarbageStats, err error) {
+	defer fail.Around(&err)
+
+	common.TimelineBegin("holotree gc start")
+	defer common.TimelineEnd()
+
+	completed := pathlib.LockWaitMessage("Serialized holotree garbage collection [holotree lock]")
+	locker, err := pathlib.Locker(common.HolotreeLock(), 30000)
+	completed()
+	fail.On(err != nil, "Could not get lock for holotree. Quiting.")
+	defer locker.Release()
+
+	marked, catalogs, err := MarkReferencedDigests()
+	fail.On(err != nil, "%v", err)
+	common.Debug("Holotree gc marked %d digests from %d catalogs.", len(marked), catalogs)
+	stats, err = SweepLibrary(marked, dryrun)
+	fail.On(err != nil, "%v", err)
+	stats.Catalogs = uint64(catalogs)
+	return stats, nil
+}
@@ -0,0 +1,115 @@
+package htfs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/hamlet"
+	"github.com/robocorp/rcc/pathlib"
+)
+
+func libraryObjectFixture(filename string) error {
+	err := os.MkdirAll(filepath.Dir(filename), 0o755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, []byte("content"), 0o644)
+}
+
+func TestGarbageCollectionSweepsOnlyUnreferencedObjects(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	t.Setenv("ROBOCORP_HOME", t.TempDir())
+	catalog := catalogFixture()
+	must.Nil(os.MkdirAll(common.HololibCatalogLocation(), 0o755))
+	must.Nil(catalog.SaveAs(filepath.Join(common.HololibCatalogLocation(), CatalogName(catalog.Blueprint))))
+
+	object := func(digest string) string {
+		return filepath.Join(common.HololibLibraryLocation(), guessLocation(digest))
+	}
+	referenced := catalog.Tree.Dirs["bin"].Files["python"].Digest
+	unreferenced := strings.Repeat("ab", 32)
+	link := filepath.Join(common.HololibLinksLocation(), unreferenced+".0644")
+	for _, filename := range []string{object(referenced), object(unreferenced), link} {
+		must.Nil(libraryObjectFixture(filename))
+	}
+
+	marked, count, err := MarkReferencedDigests()
+	must.Nil(err)
+	must.Equal(1, count)
+	must.True(marked[referenced])
+	wont.True(marked[unreferenced])
+
+	stats, err := SweepLibrary(marked, true)
+	must.Nil(err)
+	must.Equal(uint64(3), stats.Objects)
+	must.Equal(uint64(2), stats.Garbage)
+	must.True(pathlib.IsFile(object(unreferenced)))
+
+	stats, err = SweepLibrary(marked, false)
+	must.Nil(err)
+	must.Equal(uint64(2), stats.Garbage)
+	must.True(pathlib.IsFile(object(referenced)))
+	wont.True(pathlib.IsFile(object(unreferenced)))
+	wont.True(pathlib.IsFile(link))
+}
+
+func TestGarbageCollectionRewritesAndDropsPacks(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	t.Setenv("ROBOCORP_HOME", t.TempDir())
+	referenced, kept := packedObject("referenced")
+	unreferenced, dropped := packedObject("unreferenced")
+	orphan, lonely := packedObject("orphan")
+
+	mixed, err := newPackWriter(common.HololibPackLocation())
+	must.Nil(err)
+	must.Nil(mixed.append(referenced, kept))
+	must.Nil(mixed.append(unreferenced, dropped))
+	must.Nil(mixed.finish())
+	garbage, err := newPackWriter(common.HololibPackLocation())
+	must.Nil(err)
+	must.Nil(garbage.append(orphan, lonely))
+	must.Nil(garbage.finish())
+	packs.forget()
+
+	marked := map[string]bool{referenced: true}
+	stats, err := SweepLibrary(marked, true)
+	must.Nil(err)
+	must.Equal(uint64(3), stats.Objects)
+	must.Equal(uint64(2), stats.Garbage)
+	must.Equal(uint64(len(dropped)+len(lonely)), stats.Reclaimed)
+	must.Equal(2, len(packIndexFiles()))
+	must.True(IsPacked(orphan))
+
+	stats, err = SweepLibrary(marked, false)
+	must.Nil(err)
+	must.Equal(uint64(2), stats.Garbage)
+	must.Equal(1, len(packIndexFiles()))
+	wont.True(pathlib.IsFile(mixed.filename + ".pack"))
+	wont.True(pathlib.IsFile(garbage.filename + ".pack"))
+	wont.True(IsPacked(unreferenced))
+	wont.True(IsPacked(orphan))
+	content, err := readPacked(referenced)
+	must.Nil(err)
+	must.Equal(kept, content)
+
+	stats, err = SweepLibrary(marked, false)
+	must.Nil(err)
+	must.Equal(uint64(1), stats.Objects)
+	must.Equal(uint64(0), stats.Garbage)
+}
+
+func TestGarbageCollectionRefusesToMarkWithBrokenCatalogs(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	t.Setenv("ROBOCORP_HOME", t.TempDir())
+	broken := filepath.Join(common.HololibCatalogLocation(), CatalogName(strings.Repeat("f", 16)))
+	must.Nil(libraryObjectFixture(broken))
+
+	_, _, err := MarkReferencedDigests()
+	wont.Nil(err)
+}
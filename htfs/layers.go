@@ -0,0 +1,78 @@
+package htfs
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/conda"
+	"github.com/robocorp/rcc/fail"
+)
+
+type condaLayers struct {
+	library *hololib
+}
+
+// copyLibrary hides hololib from linking restore modes, since environment is
+// built on top of layers in holotree stage, and that must never write into
+// hardlinked or reflinked hololib objects.
+type copyLibrary struct {
+	Library
+}
+
+func CondaLayers(tree MutableLibrary) conda.Layers {
+	library, ok := tree.(*hololib)
+	if !ok {
+		return nil
+	}
+	return &condaLayers{library}
+}
+
+func (it *condaLayers) HasLayer(blueprint []byte) bool {
+	return it.library.HasBlueprint(blueprint)
+}
+
+func (it *condaLayers) RecordLayer(blueprint []byte, targetFolder string) (err error) {
+	defer fail.Around(&err)
+
+	key := BlueprintHash(blueprint)
+	fail.On(targetFolder != it.library.Stage(), "Conda layer can only be recorded from holotree stage, not from %q.", targetFolder)
+	identityfile := filepath.Join(targetFolder, "identity.yaml")
+	err = os.WriteFile(identityfile, blueprint, 0o644)
+	fail.On(err != nil, "Failed to save %q, reason %v.", identityfile, err)
+	defer os.Remove(identityfile)
+	common.Debug("Recording conda layer %q from %q.", key, targetFolder)
+	err = it.library.Record(blueprint)
+	fail.On(err != nil, "Failed to record conda layer %q, reason: %v", key, err)
+	forgetBlueprint(it.library, key)
+	return nil
+}
+
+func (it *condaLayers) RestoreLayer(blueprint []byte, targetFolder string) (key string, err error) {
+	defer fail.Around(&err)
+
+	key = BlueprintHash(blueprint)
+	common.TimelineBegin("holotree conda layer restore start [%s]", key)
+	defer common.TimelineEnd()
+	catalog := it.library.CatalogPath(key)
+	err = VerifyCatalog(catalog)
+	fail.On(err != nil, "%v", err)
+	err = os.MkdirAll(targetFolder, 0o755)
+	fail.On(err != nil, "Failed to create %q -> %v", targetFolder, err)
+	fs, err := NewRoot(targetFolder)
+	fail.On(err != nil, "Failed to create root -> %v", err)
+	err = fs.LoadFrom(catalog)
+	fail.On(err != nil, "Failed to load conda layer %s -> %v", catalog, err)
+	err = fs.Relocate(targetFolder)
+	fail.On(err != nil, "Failed to relocate conda layer to %s -> %v", targetFolder, err)
+	err = fs.Treetop(MakeBranches)
+	fail.On(err != nil, "Failed to make branches -> %v", err)
+	score := &stats{}
+	err = fs.AllDirs(RestoreDirectory(copyLibrary{it.library}, fs, make(map[string]string), score))
+	fail.On(err != nil, "Failed to restore conda layer -> %v", err)
+	err = os.Remove(filepath.Join(targetFolder, "identity.yaml"))
+	fail.On(err != nil, "Failed to remove conda layer identity -> %v", err)
+	touchUsedHash(key)
+	common.Debug("Conda layer %q restored into %q [%d/%d].", key, targetFolder, score.dirty, score.total)
+	return key, nil
+}
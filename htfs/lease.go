@@ -0,0 +1,293 @@
+package htfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/fail"
+	"github.com/robocorp/rcc/pathlib"
+	"github.com/robocorp/rcc/pretty"
+)
+
+const (
+	LeaseWait     = "wait"
+	LeaseFail     = "fail"
+	LeaseFallback = "fallback"
+
+	leaseVariable  = "RCC_SPACE_LEASE"
+	fallbackSuffix = "-fallback"
+	leaseHeartbeat = 15 * time.Second
+	leaseTimeout   = 4 * leaseHeartbeat
+	leaseRetry     = 2 * time.Second
+)
+
+var (
+	activeLease   *Lease
+	leaseDeadline = 30 * time.Minute
+)
+
+type Lease struct {
+	Pid        int       `json:"pid"`
+	Host       string    `json:"host"`
+	Controller string    `json:"controller"`
+	Space      string    `json:"space"`
+	Started    string    `json:"started"`
+	Heartbeat  time.Time `json:"-"`
+	filename   string
+	stop       chan bool
+}
+
+func LeasePolicy() string {
+	policy := strings.ToLower(strings.TrimSpace(common.LeasePolicy))
+	switch policy {
+	case LeaseFail, LeaseFallback:
+		return policy
+	default:
+		return LeaseWait
+	}
+}
+
+func LeaseFile(targetdir string) string {
+	return targetdir + ".lease"
+}
+
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return name
+}
+
+func LoadLease(targetdir string) (*Lease, bool) {
+	return readLease(LeaseFile(targetdir))
+}
+
+func readLease(filename string) (*Lease, bool) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, false
+	}
+	lease := &Lease{filename: filename}
+	if json.Unmarshal(content, lease) != nil {
+		return nil, false
+	}
+	lease.Heartbeat, err = pathlib.Modtime(filename)
+	if err != nil {
+		return nil, false
+	}
+	return lease, lease.Active()
+}
+
+func (it *Lease) Active() bool {
+	if time.Since(it.Heartbeat) > leaseTimeout {
+		return false
+	}
+	return it.Host != hostname() || processAlive(it.Pid)
+}
+
+func (it *Lease) token() string {
+	return fmt.Sprintf("%d@%s:%s", it.Pid, it.Host, it.filename)
+}
+
+func (it *Lease) inherited() bool {
+	return os.Getenv(leaseVariable) == it.token()
+}
+
+func (it *Lease) String() string {
+	return fmt.Sprintf("pid %d on %s since %s", it.Pid, it.Host, it.Started)
+}
+
+func (it *Lease) heartbeat() {
+	for {
+		select {
+		case <-it.stop:
+			return
+		case <-time.After(leaseHeartbeat):
+			now := time.Now()
+			os.Chtimes(it.filename, now, now)
+		}
+	}
+}
+
+func (it *Lease) save() error {
+	content, err := json.MarshalIndent(it, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(it.filename, content, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = pathlib.MakeSharedFile(it.filename)
+	return err
+}
+
+func tryLease(targetdir, space string) (holder *Lease, err error) {
+	defer fail.Around(&err)
+
+	completed := pathlib.LockWaitMessage("Serialized space lease [holotree base lock]")
+	locker, err := pathlib.Locker(targetdir+".lck", 30000)
+	completed()
+	fail.On(err != nil, "Could not get lock for %s. Quiting.", targetdir)
+	defer locker.Release()
+
+	found, active := LoadLease(targetdir)
+	if active && (found.Pid != os.Getpid() || found.Host != hostname()) {
+		if found.inherited() {
+			common.Debug("Space %q is leased by parent process %s.", targetdir, found)
+			return nil, nil
+		}
+		return found, nil
+	}
+	if activeLease != nil && activeLease.filename == LeaseFile(targetdir) {
+		return nil, nil
+	}
+	ReleaseLease()
+	lease := &Lease{
+		Pid:        os.Getpid(),
+		Host:       hostname(),
+		Controller: common.ControllerIdentity(),
+		Space:      space,
+		Started:    time.Now().Format(time.RFC3339),
+		filename:   LeaseFile(targetdir),
+		stop:       make(chan bool),
+	}
+	err = lease.save()
+	fail.On(err != nil, "Could not save lease %q, reason: %v", lease.filename, err)
+	activeLease = lease
+	os.Setenv(leaseVariable, lease.token())
+	go lease.heartbeat()
+	common.Timeline("space lease %q taken", targetdir)
+	return nil, nil
+}
+
+func poolMembers(space string) []string {
+	if common.SpacePool < 1 || TargetedSpace() {
+		return []string{space}
+	}
+	result := make([]string, 0, common.SpacePool)
+	for at := 1; at <= common.SpacePool; at++ {
+		result = append(result, fmt.Sprintf("%s-%d", space, at))
+	}
+	return result
+}
+
+func poolMembership(space string) (string, int) {
+	pool := common.HolotreePool
+	if len(pool) == 0 || !strings.HasPrefix(space, pool+"-") {
+		return "", 0
+	}
+	return pool, common.SpacePool
+}
+
+func leaseAny(library Library, blueprint []byte, candidates []string) (holder *Lease, err error) {
+	defer fail.Around(&err)
+
+	for _, candidate := range candidates {
+		location, err := library.TargetDir(blueprint, []byte(common.ControllerIdentity()), []byte(candidate))
+		fail.On(err != nil, "%v", err)
+		_, targetdir, _ := SpaceFiles(filepath.Dir(location), filepath.Base(location))
+		holder, err = tryLease(targetdir, candidate)
+		fail.On(err != nil, "%v", err)
+		if holder == nil {
+			common.HolotreeSpace = candidate
+			return nil, nil
+		}
+	}
+	return holder, nil
+}
+
+func LeaseSpace(library Library, blueprint []byte) (err error) {
+	defer fail.Around(&err)
+
+	policy := LeasePolicy()
+	space := common.HolotreeSpace
+	candidates := poolMembers(space)
+	if len(candidates) > 1 || candidates[0] != space {
+		common.HolotreePool = space
+	}
+	started := time.Now()
+	var completed func()
+	defer func() {
+		if completed != nil {
+			completed()
+		}
+	}()
+	for {
+		holder, err := leaseAny(library, blueprint, candidates)
+		fail.On(err != nil, "%v", err)
+		if holder == nil {
+			return nil
+		}
+		fail.On(policy == LeaseFail && len(candidates) > 1, "All %d spaces of pool %q are leased, and lease policy is %q.", len(candidates), space, policy)
+		fail.On(policy == LeaseFail, "Space %q is leased by %s, and lease policy is %q.", holder.Space, holder, policy)
+		if policy == LeaseFallback && !TargetedSpace() && !strings.HasSuffix(space, fallbackSuffix) {
+			space += fallbackSuffix
+			pretty.Note("Space %q is leased by %s, using space %q instead.", holder.Space, holder, space)
+			candidates = []string{space}
+			common.HolotreePool = ""
+			continue
+		}
+		fail.On(time.Since(started) > leaseDeadline, "Space %q is leased by %s, gave up waiting for it after %s.", holder.Space, holder, leaseDeadline)
+		if completed == nil {
+			common.Debug("Space %q is leased by %s, waiting for it.", holder.Space, holder)
+			completed = pathlib.LockWaitMessage(fmt.Sprintf("Serialized space use [space %q lease held by %s]", holder.Space, holder))
+		}
+		time.Sleep(leaseRetry)
+	}
+}
+
+func ReleaseLease() {
+	if activeLease == nil {
+		return
+	}
+	close(activeLease.stop)
+	found, _ := readLease(activeLease.filename)
+	if found != nil && found.Pid == activeLease.Pid && found.Host == activeLease.Host {
+		os.Remove(activeLease.filename)
+	}
+	common.Timeline("space lease %q released", activeLease.filename)
+	activeLease = nil
+}
+
+type PoolUsage struct {
+	Name   string
+	Size   int
+	Leased int
+}
+
+func (it *PoolUsage) String() string {
+	return fmt.Sprintf("%s [%d/%d leased]", it.Name, it.Leased, it.Size)
+}
+
+func PoolUtilisation(spaces []*Root) map[string]*PoolUsage {
+	result := make(map[string]*PoolUsage)
+	for _, space := range spaces {
+		if len(space.Pool) == 0 {
+			continue
+		}
+		key := space.PoolKey()
+		usage, ok := result[key]
+		if !ok {
+			usage = &PoolUsage{Name: space.Pool}
+			result[key] = usage
+		}
+		if space.PoolSize > usage.Size {
+			usage.Size = space.PoolSize
+		}
+		if _, active := LoadLease(space.Path); active {
+			usage.Leased += 1
+		}
+	}
+	return result
+}
+
+func (it *Root) PoolKey() string {
+	return it.Controller + " " + it.Pool
+}
@@ -0,0 +1,87 @@
+package htfs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/hamlet"
+)
+
+func TestLeaseIsActiveOnlyWithLiveProcessAndHeartbeat(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	targetdir := filepath.Join(t.TempDir(), "space")
+	lease := &Lease{Pid: os.Getpid(), Host: hostname(), Space: "test", filename: LeaseFile(targetdir)}
+	must.Nil(lease.save())
+
+	found, active := LoadLease(targetdir)
+	must.True(active)
+	must.Equal(os.Getpid(), found.Pid)
+	must.Equal("test", found.Space)
+
+	stale := time.Now().Add(-2 * leaseTimeout)
+	must.Nil(os.Chtimes(lease.filename, stale, stale))
+	_, active = LoadLease(targetdir)
+	wont.True(active)
+
+	lease.Pid = 0x7ffffff0
+	must.Nil(lease.save())
+	_, active = LoadLease(targetdir)
+	wont.True(active)
+
+	lease.Host = "elsewhere"
+	must.Nil(lease.save())
+	_, active = LoadLease(targetdir)
+	must.True(active)
+}
+
+func TestSpacePoolMembersAndMembership(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	defer func(size int, pool string) {
+		common.SpacePool, common.HolotreePool = size, pool
+	}(common.SpacePool, common.HolotreePool)
+
+	common.SpacePool = 0
+	must.Equal([]string{"robot"}, poolMembers("robot"))
+
+	common.SpacePool = 3
+	must.Equal([]string{"robot-1", "robot-2", "robot-3"}, poolMembers("robot"))
+
+	common.HolotreePool = "robot"
+	pool, size := poolMembership("robot-2")
+	must.Equal("robot", pool)
+	must.Equal(3, size)
+
+	pool, size = poolMembership("other-2")
+	wont.Equal("robot", pool)
+	must.Equal(0, size)
+}
+
+func TestWaitingForLeaseGivesUpAfterDeadline(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	defer func(space, policy string, size int, deadline time.Duration) {
+		common.HolotreeSpace, common.LeasePolicy, common.SpacePool, leaseDeadline = space, policy, size, deadline
+	}(common.HolotreeSpace, common.LeasePolicy, common.SpacePool, leaseDeadline)
+
+	t.Setenv("ROBOCORP_HOME", t.TempDir())
+	tree, err := New()
+	must.Nil(err)
+	blueprint := []byte("leased")
+	common.HolotreeSpace, common.LeasePolicy, common.SpacePool = "leased", LeaseWait, 0
+	targetdir, err := tree.TargetDir(blueprint, []byte(common.ControllerIdentity()), []byte(common.HolotreeSpace))
+	must.Nil(err)
+	must.Nil(os.MkdirAll(filepath.Dir(targetdir), 0o755))
+	lease := &Lease{Pid: os.Getpid(), Host: "elsewhere", Space: "leased", filename: LeaseFile(targetdir)}
+	must.Nil(lease.save())
+
+	leaseDeadline = 0
+	err = LeaseSpace(tree, blueprint)
+	wont.Nil(err)
+	must.True(strings.Contains(err.Error(), "gave up waiting"))
+}
@@ -2,6 +2,7 @@ package htfs
 
 import (
 	"archive/zip"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"os"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/robocorp/rcc/cloud"
 	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/conda"
 	"github.com/robocorp/rcc/fail"
 	"github.com/robocorp/rcc/journal"
 	"github.com/robocorp/rcc/pathlib"
@@ -106,7 +108,8 @@ func (it *hololib) Stage() string {
 
 type zipseen struct {
 	*zip.Writer
-	seen map[string]bool
+	seen     map[string]bool
+	manifest *Manifest
 }
 
 func (it zipseen) Ignore(relativepath string) {
@@ -119,15 +122,27 @@ func (it zipseen) Add(fullpath, relativepath string) (err error) {
 	if it.seen[relativepath] {
 		return nil
 	}
-	it.seen[relativepath] = true
 
 	source, err := os.Open(fullpath)
 	fail.On(err != nil, "Could not open: %q -> %v", fullpath, err)
 	defer source.Close()
+	return it.AddFrom(source, relativepath)
+}
+
+func (it zipseen) AddFrom(source io.Reader, relativepath string) (err error) {
+	defer fail.Around(&err)
+
+	if it.seen[relativepath] {
+		return nil
+	}
+	it.seen[relativepath] = true
+
 	target, err := it.Create(relativepath)
 	fail.On(err != nil, "Could not create: %q -> %v", relativepath, err)
-	_, err = io.Copy(target, source)
-	fail.On(err != nil, "Copy failure: %q -> %q -> %v", fullpath, relativepath, err)
+	digester := sha256.New()
+	size, err := io.Copy(io.MultiWriter(target, digester), source)
+	fail.On(err != nil, "Copy failure: %q -> %v", relativepath, err)
+	it.manifest.added(relativepath, size, fmt.Sprintf("%02x", digester.Sum(nil)))
 	return nil
 }
 
@@ -163,6 +178,7 @@ func (it *hololib) Export(catalogs, known []string, archive string) (err error)
 	zipper := &zipseen{
 		writer,
 		make(map[string]bool),
+		newManifest(),
 	}
 
 	exported := false
@@ -185,6 +201,11 @@ func (it *hololib) Export(catalogs, known []string, archive string) (err error)
 		fail.On(err != nil, "Could not get relative location for catalog -> %v.", err)
 		err = zipper.Add(catalog, relative)
 		fail.On(err != nil, "Could not add catalog to zip -> %v.", err)
+		signature := SignatureLocation(catalog)
+		if pathlib.IsFile(signature) {
+			err = zipper.Add(signature, signatureEntry(catalog))
+			fail.On(err != nil, "Could not add catalog signature to zip -> %v.", err)
+		}
 
 		fs, err := NewRoot(".")
 		fail.On(err != nil, "Could not create root location -> %v.", err)
@@ -192,9 +213,12 @@ func (it *hololib) Export(catalogs, known []string, archive string) (err error)
 		fail.On(err != nil, "Could not load catalog from %s -> %v.", catalog, err)
 		err = fs.Treetop(ZipRoot(it, fs, zipper))
 		fail.On(err != nil, "Could not zip catalog %s -> %v.", catalog, err)
+		zipper.manifest.catalog(name, fs)
 		exported = true
 	}
 	fail.On(!exported, "None of given catalogs were available for export!")
+	err = zipper.manifest.write(writer)
+	fail.On(err != nil, "Could not add manifest to zip -> %v.", err)
 	return nil
 }
 
@@ -206,6 +230,7 @@ func (it *hololib) Record(blueprint []byte) error {
 	if err != nil {
 		return err
 	}
+	fs.Bytecode = bytecodePolicy(blueprint)
 	err = fs.Lift()
 	if err != nil {
 		return err
@@ -217,7 +242,7 @@ func (it *hololib) Record(blueprint []byte) error {
 	}
 	common.Timeline("holotree (re)locator done")
 	fs.Blueprint = key
-	catalog := it.CatalogPath(key)
+	catalog := catalogFile(key)
 	err = fs.SaveAs(catalog)
 	if err != nil {
 		return err
@@ -231,14 +256,45 @@ func (it *hololib) Record(blueprint []byte) error {
 	return err
 }
 
+// bytecodePolicy returns precompilation policy of blueprint, when its
+// bytecode files should be recorded into catalog.
+func bytecodePolicy(blueprint []byte) string {
+	policy := conda.PrecompilePolicy(blueprint)
+	if policy == conda.PrecompileNone {
+		return ""
+	}
+	return policy
+}
+
+const (
+	catalogSuffix       = "v13."
+	legacyCatalogSuffix = "v12."
+)
+
 func CatalogName(key string) string {
-	return fmt.Sprintf("%sv12.%s", key, common.Platform())
+	return fmt.Sprintf("%s%s%s", key, catalogSuffix, common.Platform())
 }
 
-func (it *hololib) CatalogPath(key string) string {
+func legacyCatalogName(key string) string {
+	return fmt.Sprintf("%s%s%s", key, legacyCatalogSuffix, common.Platform())
+}
+
+// catalogFile is where catalog of blueprint is written, always in binary form.
+func catalogFile(key string) string {
 	return filepath.Join(common.HololibCatalogLocation(), CatalogName(key))
 }
 
+// CatalogPath falls back to legacy catalog, when blueprint does not have
+// binary catalog (yet), since both formats are readable.
+func (it *hololib) CatalogPath(key string) string {
+	catalog := catalogFile(key)
+	legacy := filepath.Join(common.HololibCatalogLocation(), legacyCatalogName(key))
+	if !pathlib.IsFile(catalog) && pathlib.IsFile(legacy) {
+		return legacy
+	}
+	return catalog
+}
+
 func (it *hololib) ValidateBlueprint(blueprint []byte) error {
 	return nil
 }
@@ -253,6 +309,12 @@ func (it *hololib) HasBlueprint(blueprint []byte) bool {
 	return found
 }
 
+func forgetBlueprint(library Library, key string) {
+	if cached, ok := library.(*hololib); ok {
+		delete(cached.queryCache, key)
+	}
+}
+
 func (it *hololib) queryBlueprint(key string) bool {
 	common.Timeline("holotree blueprint query")
 	catalog := it.CatalogPath(key)
@@ -277,12 +339,30 @@ func (it *hololib) queryBlueprint(key string) bool {
 		common.Debug("Catalog check failed, reason: %v", err)
 		return false
 	}
+	if filepath.Base(catalog) == legacyCatalogName(key) {
+		_, _, err = migrateLegacyCatalog(catalog)
+		if err != nil {
+			common.Debug("%v", err)
+		}
+	}
 	return pathlib.IsFile(catalog)
 }
 
 func Catalogs() []string {
 	result := make([]string, 0, 10)
-	for _, catalog := range pathlib.Glob(common.HololibCatalogLocation(), "[0-9a-f]*v12.*") {
+	for _, catalog := range pathlib.Glob(common.HololibCatalogLocation(), "[0-9a-f]*"+catalogSuffix+"*") {
+		result = append(result, catalog)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// LegacyCatalogs are JSON catalogs written by older rcc versions. They are
+// not used for environments, but they are kept (and their objects with them)
+// for those older versions sharing same hololib.
+func LegacyCatalogs() []string {
+	result := make([]string, 0, 10)
+	for _, catalog := range pathlib.Glob(common.HololibCatalogLocation(), "[0-9a-f]*"+legacyCatalogSuffix+"*") {
 		result = append(result, catalog)
 	}
 	sort.Strings(result)
@@ -335,7 +415,7 @@ func (it *hololib) TargetDir(blueprint, controller, space []byte) (result string
 	fs, err := NewRoot(it.Stage())
 	fail.On(err != nil, "Failed to create stage -> %v", err)
 	name := ControllerSpaceName(controller, space)
-	err = fs.LoadFrom(catalog)
+	err = fs.LoadHeaderFrom(catalog)
 	if err != nil {
 		return filepath.Join(common.HolotreeLocation(), name), nil
 	}
@@ -355,13 +435,13 @@ func (it *hololib) Restore(blueprint, client, tag []byte) (result string, err er
 	common.TimelineBegin("holotree space restore start [%s]", key)
 	defer common.TimelineEnd()
 	name := ControllerSpaceName(client, tag)
+	err = VerifyCatalog(catalog)
+	fail.On(err != nil, "%v", err)
 	fs, err := NewRoot(it.Stage())
 	fail.On(err != nil, "Failed to create stage -> %v", err)
 	err = fs.LoadFrom(catalog)
 	fail.On(err != nil, "Failed to load catalog %s -> %v", catalog, err)
-	metafile := filepath.Join(fs.HolotreeBase(), fmt.Sprintf("%s.meta", name))
-	targetdir := filepath.Join(fs.HolotreeBase(), name)
-	lockfile := filepath.Join(fs.HolotreeBase(), fmt.Sprintf("%s.lck", name))
+	metafile, targetdir, lockfile := SpaceFiles(fs.HolotreeBase(), name)
 	completed := pathlib.LockWaitMessage("Serialized holotree restore [holotree base lock]")
 	locker, err := pathlib.Locker(lockfile, 30000)
 	completed()
@@ -370,11 +450,13 @@ func (it *hololib) Restore(blueprint, client, tag []byte) (result string, err er
 	journal.Post("space-used", metafile, "normal holotree with blueprint %s from %s", key, catalog)
 	currentstate := make(map[string]string)
 	mode := fmt.Sprintf("new space for %q", key)
+	var previous *Root
 	shadow, err := NewRoot(targetdir)
 	if err == nil {
 		err = shadow.LoadFrom(metafile)
 	}
 	if err == nil {
+		previous = shadow
 		if key == shadow.Blueprint {
 			mode = fmt.Sprintf("cleaned up space for %q", key)
 		} else {
@@ -386,8 +468,10 @@ func (it *hololib) Restore(blueprint, client, tag []byte) (result string, err er
 	}
 	common.Timeline("mode: %s", mode)
 	common.Debug("Holotree operating mode is: %s", mode)
-	err = fs.Relocate(targetdir)
+	protect := protecting(it, previous)
+	err = relocateSpace(fs, previous, targetdir)
 	fail.On(err != nil, "Failed to relocate %s -> %v", targetdir, err)
+	swap := swapping(fs, targetdir, currentstate)
 	common.TimelineBegin("holotree make branches start")
 	err = fs.Treetop(MakeBranches)
 	common.TimelineEnd()
@@ -400,8 +484,15 @@ func (it *hololib) Restore(blueprint, client, tag []byte) (result string, err er
 	defer common.Timeline("- dirty %d/%d", score.dirty, score.total)
 	common.Debug("Holotree dirty workload: %d/%d\n", score.dirty, score.total)
 	journal.CurrentBuildEvent().Dirty(score.Dirtyness())
+	err = fs.RelocationReport()
+	fail.On(err != nil, "%v", err)
+	err = swap()
+	fail.On(err != nil, "Failed to swap in %q -> %v", targetdir, err)
+	err = protect(fs)
+	fail.On(err != nil, "Failed to protect %q -> %v", targetdir, err)
 	fs.Controller = string(client)
 	fs.Space = string(tag)
+	fs.Pool, fs.PoolSize = poolMembership(string(tag))
 	err = fs.SaveAs(metafile)
 	fail.On(err != nil, "Failed to save metafile %q -> %v", metafile, err)
 	pathlib.TouchWhen(catalog, time.Now())
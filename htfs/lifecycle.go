@@ -0,0 +1,243 @@
+package htfs
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/fail"
+	"github.com/robocorp/rcc/pathlib"
+	"github.com/robocorp/rcc/settings"
+)
+
+const (
+	pruneInterval = 24 * time.Hour
+	pruneBudget   = 5
+)
+
+type Lifecycle struct {
+	Identity   string    `json:"identity"`
+	Controller string    `json:"controller"`
+	Space      string    `json:"space"`
+	Blueprint  string    `json:"blueprint"`
+	Path       string    `json:"path"`
+	LastUsed   time.Time `json:"last-used"`
+	LastRun    time.Time `json:"last-run,omitempty"`
+	UnusedDays int       `json:"unused-days"`
+	Pruned     bool      `json:"pruned"`
+	Reason     string    `json:"reason"`
+}
+
+type Lifecycles []*Lifecycle
+
+func LastUsedFile(targetdir string) string {
+	return targetdir + ".lastused"
+}
+
+func LastRunFile(targetdir string) string {
+	return targetdir + ".lastrun"
+}
+
+func pruneStamp() string {
+	return filepath.Join(common.HolotreeLocation(), fmt.Sprintf("%s.pruned", common.UserHomeIdentity()))
+}
+
+func MarkSpaceUsed(targetdir string) {
+	pathlib.ForceTouchWhen(LastUsedFile(targetdir), time.Now())
+}
+
+func MarkSpaceRun(targetdir string) {
+	now := time.Now()
+	pathlib.ForceTouchWhen(LastUsedFile(targetdir), now)
+	pathlib.ForceTouchWhen(LastRunFile(targetdir), now)
+}
+
+func latest(candidates ...string) time.Time {
+	result := time.Time{}
+	for _, candidate := range candidates {
+		stamp, err := pathlib.Modtime(candidate)
+		if err == nil && stamp.After(result) {
+			result = stamp
+		}
+	}
+	return result
+}
+
+func SpaceLifecycle(space *Root) *Lifecycle {
+	// spaces restored before lifecycle tracking only have their metafile
+	lastUsed := latest(space.Path+".meta", LastUsedFile(space.Path), LastRunFile(space.Path))
+	return &Lifecycle{
+		Identity:   space.Identity,
+		Controller: space.Controller,
+		Space:      space.Space,
+		Blueprint:  space.Blueprint,
+		Path:       space.Path,
+		LastUsed:   lastUsed,
+		LastRun:    latest(LastRunFile(space.Path)),
+		UnusedDays: common.DayCountSince(lastUsed),
+	}
+}
+
+func SpaceLifecycles(spaces []*Root) Lifecycles {
+	result := make(Lifecycles, 0, len(spaces))
+	for _, space := range spaces {
+		result = append(result, SpaceLifecycle(space))
+	}
+	sort.SliceStable(result, func(left, right int) bool {
+		if result[left].Controller != result[right].Controller {
+			return result[left].Controller < result[right].Controller
+		}
+		return result[left].LastUsed.After(result[right].LastUsed)
+	})
+	return result
+}
+
+// Expire marks spaces unused for at least given days as pruned, but always
+// keeps given number of most recently used spaces per controller.
+func (it Lifecycles) Expire(unusedDays, keepPerController int) {
+	kept := make(map[string]int)
+	for _, space := range it {
+		kept[space.Controller] += 1
+		switch {
+		case kept[space.Controller] <= keepPerController:
+			space.Reason = fmt.Sprintf("one of %d most recently used", keepPerController)
+		case space.UnusedDays < unusedDays:
+			space.Reason = fmt.Sprintf("used %d days ago", space.UnusedDays)
+		default:
+			space.Pruned = true
+			space.Reason = fmt.Sprintf("unused for %d days", space.UnusedDays)
+		}
+	}
+}
+
+// Limit keeps at most given number of spaces marked as pruned, and leaves
+// rest of them for later prunes.
+func (it Lifecycles) Limit(count int) {
+	for _, space := range it {
+		if !space.Pruned {
+			continue
+		}
+		if count > 0 {
+			count -= 1
+			continue
+		}
+		space.Pruned = false
+		space.Reason = "left for next prune"
+	}
+}
+
+func (it Lifecycles) Pruned() int {
+	total := 0
+	for _, space := range it {
+		if space.Pruned {
+			total += 1
+		}
+	}
+	return total
+}
+
+func spaceBusy(targetdir string) bool {
+	if _, active := LoadLease(targetdir); active {
+		return true
+	}
+	locker, ok := pathlib.TryLocker(UsageFile(targetdir))
+	if !ok {
+		return true
+	}
+	locker.Release()
+	return false
+}
+
+func pruneSpace(space *Lifecycle) (err error) {
+	defer fail.Around(&err)
+
+	locker, ok := pathlib.TryLocker(space.Path + ".lck")
+	fail.On(!ok, "space is locked by other process")
+	defer locker.Release()
+	fail.On(spaceBusy(space.Path), "space is in use")
+	// lockfile is held here and others may be waiting on it, so it stays
+	return removeSpace(space.Path, space.Path+".meta")
+}
+
+func pruneSpaces(spaces Lifecycles, dryrun bool) {
+	for _, space := range spaces {
+		if !space.Pruned {
+			continue
+		}
+		if dryrun {
+			common.Debug("Would prune space %q, %s.", space.Identity, space.Reason)
+			continue
+		}
+		err := pruneSpace(space)
+		if err != nil {
+			space.Pruned = false
+			space.Reason = err.Error()
+			continue
+		}
+		common.Debug("Pruned space %q, %s.", space.Identity, space.Reason)
+	}
+}
+
+// PruneSpaces removes spaces that have not been used for given number of days,
+// while keeping given number of most recently used spaces per controller.
+func PruneSpaces(unusedDays, keepPerController int, dryrun bool) (result Lifecycles, err error) {
+	defer fail.Around(&err)
+
+	common.TimelineBegin("holotree prune start")
+	defer common.TimelineEnd()
+
+	completed := pathlib.LockWaitMessage("Serialized holotree prune [holotree lock]")
+	locker, err := pathlib.Locker(common.HolotreeLock(), 30000)
+	completed()
+	fail.On(err != nil, "Could not get lock for holotree. Quiting.")
+	defer locker.Release()
+
+	result = SpaceLifecycles(Spaces())
+	result.Expire(unusedDays, keepPerController)
+	pruneSpaces(result, dryrun)
+	return result, nil
+}
+
+func ownSpaces() []*Root {
+	prefix := common.UserHomeIdentity() + "_"
+	result := make([]*Root, 0, 10)
+	for _, space := range Spaces() {
+		if strings.HasPrefix(filepath.Base(space.Path), prefix) {
+			result = append(result, space)
+		}
+	}
+	return result
+}
+
+// PruneOpportunistically applies settings.yaml prune policy at most once a
+// day, and gives up instead of waiting, when holotree or spaces are busy.
+// At most few spaces are removed at a time, rest are left for later.
+func PruneOpportunistically() {
+	unusedDays := settings.Global.HolotreePruneUnusedDays()
+	if unusedDays < 1 || common.Liveonly {
+		return
+	}
+	stamp := pruneStamp()
+	when, err := pathlib.Modtime(stamp)
+	if err == nil && time.Since(when) < pruneInterval {
+		return
+	}
+	locker, ok := pathlib.TryLocker(common.HolotreeLock())
+	if !ok {
+		common.Debug("Holotree is busy, skipping opportunistic space pruning.")
+		return
+	}
+	defer locker.Release()
+	pathlib.ForceTouchWhen(stamp, time.Now())
+
+	common.TimelineBegin("holotree opportunistic prune start")
+	defer common.TimelineEnd()
+	spaces := SpaceLifecycles(ownSpaces())
+	spaces.Expire(unusedDays, settings.Global.HolotreePruneKeepPerController())
+	spaces.Limit(pruneBudget)
+	pruneSpaces(spaces, false)
+	common.Timeline("pruned %d/%d spaces", spaces.Pruned(), len(spaces))
+}
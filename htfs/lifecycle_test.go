@@ -0,0 +1,89 @@
+package htfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/robocorp/rcc/hamlet"
+	"github.com/robocorp/rcc/pathlib"
+)
+
+func TestSpaceLifecycleFollowsUseAndRunMarkers(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	targetdir := filepath.Join(t.TempDir(), "space")
+	past := time.Now().Add(-72 * time.Hour)
+	pathlib.ForceTouchWhen(targetdir+".meta", past)
+	space := &Root{Identity: "space", Controller: "rcc.user", Path: targetdir}
+
+	life := SpaceLifecycle(space)
+	must.Equal(3, life.UnusedDays)
+	must.True(life.LastRun.IsZero())
+
+	MarkSpaceUsed(targetdir)
+	life = SpaceLifecycle(space)
+	must.Equal(0, life.UnusedDays)
+	must.True(life.LastRun.IsZero())
+
+	MarkSpaceRun(targetdir)
+	life = SpaceLifecycle(space)
+	wont.True(life.LastRun.IsZero())
+	must.True(pathlib.IsFile(LastRunFile(targetdir)))
+}
+
+func TestExpireKeepsMostRecentlyUsedPerController(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	now := time.Now()
+	spaces := Lifecycles{
+		{Identity: "a1", Controller: "a", LastUsed: now, UnusedDays: 0},
+		{Identity: "a2", Controller: "a", LastUsed: now.Add(-40 * 24 * time.Hour), UnusedDays: 40},
+		{Identity: "a3", Controller: "a", LastUsed: now.Add(-50 * 24 * time.Hour), UnusedDays: 50},
+		{Identity: "b1", Controller: "b", LastUsed: now.Add(-60 * 24 * time.Hour), UnusedDays: 60},
+		{Identity: "c1", Controller: "c", LastUsed: now.Add(-10 * 24 * time.Hour), UnusedDays: 10},
+		{Identity: "c2", Controller: "c", LastUsed: now.Add(-20 * 24 * time.Hour), UnusedDays: 20},
+	}
+	spaces.Expire(30, 1)
+
+	wont.True(spaces[0].Pruned)
+	must.True(spaces[1].Pruned)
+	must.True(spaces[2].Pruned)
+	wont.True(spaces[3].Pruned)
+	wont.True(spaces[4].Pruned)
+	wont.True(spaces[5].Pruned)
+	must.Equal(2, spaces.Pruned())
+}
+
+func TestLimitLeavesRestOfPrunedSpacesForLater(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	spaces := Lifecycles{
+		{Identity: "a1", Pruned: false},
+		{Identity: "a2", Pruned: true},
+		{Identity: "a3", Pruned: true},
+		{Identity: "a4", Pruned: true},
+	}
+	spaces.Limit(2)
+	wont.True(spaces[0].Pruned)
+	must.True(spaces[1].Pruned)
+	must.True(spaces[2].Pruned)
+	wont.True(spaces[3].Pruned)
+	must.Equal(2, spaces.Pruned())
+}
+
+func TestPruneSpaceKeepsItsHeldLockfile(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	targetdir := filepath.Join(t.TempDir(), "space")
+	must.Nil(os.MkdirAll(filepath.Join(targetdir, "bin"), 0o755))
+	pathlib.ForceTouchWhen(targetdir+".meta", time.Now())
+	MarkSpaceRun(targetdir)
+
+	must.Nil(pruneSpace(&Lifecycle{Identity: "space", Path: targetdir}))
+	wont.True(pathlib.Exists(targetdir))
+	wont.True(pathlib.Exists(targetdir + ".meta"))
+	wont.True(pathlib.Exists(LastRunFile(targetdir)))
+	must.True(pathlib.Exists(targetdir + ".lck"))
+}
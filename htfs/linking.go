@@ -0,0 +1,202 @@
+package htfs
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/pathlib"
+	"github.com/robocorp/rcc/settings"
+)
+
+const (
+	RestoreCopy     = "copy"
+	RestoreHardlink = "hardlink"
+	RestoreReflink  = "reflink"
+)
+
+var (
+	linkDirLock sync.Mutex
+	linkLocks   sync.Map
+)
+
+func RestoreMode() string {
+	mode := strings.ToLower(strings.TrimSpace(settings.Global.HolotreeRestoreMode()))
+	switch mode {
+	case RestoreHardlink, RestoreReflink:
+		return mode
+	default:
+		return RestoreCopy
+	}
+}
+
+func linkingLibrary(library Library) bool {
+	_, ok := library.(*hololib)
+	return ok
+}
+
+func linkable(details *File) bool {
+	return !details.IsSymlink() && len(details.Rewrite) == 0
+}
+
+func LinkLocation(digest string, mode fs.FileMode) string {
+	name := fmt.Sprintf("%s.%o", digest, uint32(mode))
+	return filepath.Join(common.HololibLinksLocation(), digest[:2], digest[2:4], digest[4:6], name)
+}
+
+func validLinkSource(location string, details *File) (fs.FileInfo, bool) {
+	info, err := os.Lstat(location)
+	if err != nil {
+		return nil, false
+	}
+	ok := info.Mode() == details.Mode && info.Size() == details.Size && info.ModTime().Equal(motherTime)
+	return info, ok
+}
+
+func isLinkedCorrectly(details *File, info fs.FileInfo) bool {
+	if !info.ModTime().Equal(motherTime) {
+		return false
+	}
+	source, ok := validLinkSource(LinkLocation(details.Digest, details.Mode), details)
+	return ok && os.SameFile(source, info)
+}
+
+func ensureLinkDirectory(location string) error {
+	linkDirLock.Lock()
+	defer linkDirLock.Unlock()
+
+	if pathlib.IsDir(location) {
+		return nil
+	}
+	_, err := pathlib.MakeSharedDir(location)
+	return err
+}
+
+func ensureLinkSource(library Library, details *File) (location string, err error) {
+	location = LinkLocation(details.Digest, details.Mode)
+	guard, _ := linkLocks.LoadOrStore(location, &sync.Mutex{})
+	guard.(*sync.Mutex).Lock()
+	defer guard.(*sync.Mutex).Unlock()
+
+	if _, ok := validLinkSource(location, details); ok {
+		return location, nil
+	}
+	err = ensureLinkDirectory(filepath.Dir(location))
+	if err != nil {
+		return "", err
+	}
+	reader, closer, err := library.Open(details.Digest)
+	if err != nil {
+		return "", err
+	}
+	defer closer()
+	partname := fmt.Sprintf("%s.part%s", location, <-common.Identities)
+	defer os.Remove(partname)
+	sink, err := os.Create(partname)
+	if err != nil {
+		return "", err
+	}
+	digester := sha256.New()
+	_, err = io.Copy(io.MultiWriter(sink, digester), reader)
+	sink.Close()
+	if err != nil {
+		return "", err
+	}
+	hexdigest := fmt.Sprintf("%02x", digester.Sum(nil))
+	if details.Digest != hexdigest {
+		return "", fmt.Errorf("Corrupted hololib, expected %s, actual %s", details.Digest, hexdigest)
+	}
+	err = os.Chmod(partname, details.Mode)
+	if err != nil {
+		return "", err
+	}
+	err = os.Chtimes(partname, motherTime, motherTime)
+	if err != nil {
+		return "", err
+	}
+	err = TryRename("linksource", partname, location)
+	if err != nil {
+		return "", err
+	}
+	return location, nil
+}
+
+func hardlinkFile(library Library, details *File, sinkname string) error {
+	source, err := ensureLinkSource(library, details)
+	if err != nil {
+		return err
+	}
+	partname := fmt.Sprintf("%s.part%s", sinkname, <-common.Identities)
+	defer os.Remove(partname)
+	err = os.Link(source, partname)
+	if err != nil {
+		return err
+	}
+	return TryRename("hardlink", partname, sinkname)
+}
+
+func reflinkFile(library Library, details *File, sinkname string, rewrite []byte) (err error) {
+	source, err := ensureLinkSource(library, details)
+	if err != nil {
+		return err
+	}
+	partname := fmt.Sprintf("%s.part%s", sinkname, <-common.Identities)
+	defer os.Remove(partname)
+	err = cloneFile(source, partname)
+	if err != nil {
+		return err
+	}
+	sink, err := os.OpenFile(partname, os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	for _, position := range details.Rewrite {
+		_, err = sink.WriteAt(rewrite, position)
+		if err != nil {
+			sink.Close()
+			return err
+		}
+	}
+	err = sink.Close()
+	if err != nil {
+		return err
+	}
+	err = TryRename("reflink", partname, sinkname)
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(sinkname, details.Mode)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(sinkname, motherTime, motherTime)
+}
+
+func linkFile(library Library, details *File, sinkname string, rewrite []byte) bool {
+	if !linkingLibrary(library) || details.IsSymlink() {
+		return false
+	}
+	var err error
+	switch RestoreMode() {
+	case RestoreHardlink:
+		if !linkable(details) {
+			return false
+		}
+		err = hardlinkFile(library, details, sinkname)
+	case RestoreReflink:
+		err = reflinkFile(library, details, sinkname, rewrite)
+	default:
+		return false
+	}
+	if err != nil {
+		common.Trace("* Holotree: %s of %q failed, falling back to copy, reason: %v", RestoreMode(), sinkname, err)
+		return false
+	}
+	return true
+}
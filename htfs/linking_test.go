@@ -0,0 +1,65 @@
+package htfs
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/robocorp/rcc/anywork"
+	"github.com/robocorp/rcc/hamlet"
+	"github.com/robocorp/rcc/pathlib"
+)
+
+func TestHardlinkedFilesShareLinkSourceAndDetectCopies(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	t.Setenv("ROBOCORP_HOME", t.TempDir())
+	tree, err := New()
+	must.Nil(err)
+	library := tree.(*hololib)
+
+	content := []byte("print('hello')\n")
+	digest := fmt.Sprintf("%02x", sha256.Sum256(content))
+	source := filepath.Join(t.TempDir(), "source.py")
+	must.Nil(os.WriteFile(source, content, 0o644))
+	_, err = pathlib.MakeSharedDir(library.Location(digest))
+	must.Nil(err)
+	anywork.Backlog(LiftFile(source, library.ExactLocation(digest)))
+	must.Nil(anywork.Sync())
+
+	details := &File{Name: "first.py", Size: int64(len(content)), Mode: 0o644, Digest: digest, Rewrite: []int64{}}
+	space := t.TempDir()
+	first := filepath.Join(space, "first.py")
+	second := filepath.Join(space, "second.py")
+	must.Nil(hardlinkFile(library, details, first))
+	must.Nil(hardlinkFile(library, details, second))
+
+	left, err := os.Stat(first)
+	must.Nil(err)
+	right, err := os.Stat(second)
+	must.Nil(err)
+	must.True(os.SameFile(left, right))
+	must.True(isLinkedCorrectly(details, left))
+
+	// same content, mode, size and time, but not linked is still dirty
+	copied := *details
+	copied.Name = "second.py"
+	must.Nil(os.Remove(second))
+	must.Nil(os.WriteFile(second, content, 0o644))
+	must.Nil(os.Chtimes(second, motherTime, motherTime))
+	right, err = os.Stat(second)
+	must.Nil(err)
+	must.True(copied.Match(right))
+	wont.True(isLinkedCorrectly(&copied, right))
+
+	// conda layers are restored into stage always as copies
+	must.True(linkingLibrary(library))
+	wont.True(linkingLibrary(copyLibrary{library}))
+	wont.True(linkFile(copyLibrary{library}, details, filepath.Join(space, "third.py"), nil))
+	wont.True(pathlib.Exists(filepath.Join(space, "third.py")))
+
+	wont.True(linkable(&File{Rewrite: []int64{12}}))
+	wont.True(linkable(&File{Symlink: "other"}))
+}
@@ -0,0 +1,181 @@
+package htfs
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/conda"
+	"github.com/robocorp/rcc/fail"
+	"github.com/robocorp/rcc/pretty"
+)
+
+const (
+	ManifestName = "manifest.json"
+)
+
+type ManifestCatalog struct {
+	Name       string `json:"name"`
+	Blueprint  string `json:"blueprint"`
+	Platform   string `json:"platform"`
+	RccVersion string `json:"rcc"`
+	Objects    int    `json:"objects"`
+	Size       uint64 `json:"size"`
+}
+
+type Manifest struct {
+	RccVersion string             `json:"rcc"`
+	Created    string             `json:"created"`
+	Catalogs   []*ManifestCatalog `json:"catalogs"`
+	Objects    int                `json:"objects"`
+	Size       uint64             `json:"size"`
+	Checksums  map[string]string  `json:"checksums"`
+}
+
+func newManifest() *Manifest {
+	return &Manifest{
+		RccVersion: common.Version,
+		Created:    time.Now().Format(time.RFC3339),
+		Catalogs:   make([]*ManifestCatalog, 0, 5),
+		Checksums:  make(map[string]string),
+	}
+}
+
+func (it *Manifest) added(relativepath string, size int64, checksum string) {
+	it.Checksums[relativepath] = checksum
+	if filepath.Dir(filepath.Dir(filepath.Dir(filepath.Dir(relativepath)))) == "library" {
+		it.Objects += 1
+		it.Size += uint64(size)
+	}
+}
+
+func uniqueObjects(dir *Dir, seen map[string]bool) uint64 {
+	size := uint64(0)
+	for _, file := range dir.Files {
+		if file.IsSymlink() || seen[file.Digest] {
+			continue
+		}
+		seen[file.Digest] = true
+		size += uint64(file.Size)
+	}
+	for _, subdir := range dir.Dirs {
+		size += uniqueObjects(subdir, seen)
+	}
+	return size
+}
+
+func (it *Manifest) catalog(name string, fs *Root) {
+	seen := make(map[string]bool)
+	size := uniqueObjects(fs.Tree, seen)
+	it.Catalogs = append(it.Catalogs, &ManifestCatalog{
+		Name:       name,
+		Blueprint:  fs.Blueprint,
+		Platform:   fs.Platform,
+		RccVersion: fs.RccVersion,
+		Objects:    len(seen),
+		Size:       size,
+	})
+}
+
+func (it *Manifest) write(writer *zip.Writer) error {
+	content, err := json.MarshalIndent(it, "", "  ")
+	if err != nil {
+		return err
+	}
+	sink, err := writer.Create(ManifestName)
+	if err != nil {
+		return err
+	}
+	_, err = sink.Write(content)
+	return err
+}
+
+func zipEntryChecksum(entry *zip.File) (string, error) {
+	source, err := entry.Open()
+	if err != nil {
+		return "", err
+	}
+	defer source.Close()
+	digester := sha256.New()
+	_, err = io.Copy(digester, source)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%02x", digester.Sum(nil)), nil
+}
+
+func majorVersion(text string) uint64 {
+	version, _ := conda.AsVersion(text)
+	return version / 1000000
+}
+
+func ArchiveManifest(zipfile string) (manifest *Manifest, err error) {
+	defer fail.Around(&err)
+
+	archive, err := zip.OpenReader(zipfile)
+	fail.On(err != nil, "Could not open %q, reason: %v", zipfile, err)
+	defer archive.Close()
+	for _, entry := range archive.File {
+		if entry.Name != ManifestName {
+			continue
+		}
+		source, err := entry.Open()
+		fail.On(err != nil, "Could not open manifest in %q, reason: %v", zipfile, err)
+		defer source.Close()
+		manifest = &Manifest{}
+		err = json.NewDecoder(source).Decode(manifest)
+		fail.On(err != nil, "Could not read manifest in %q, reason: %v", zipfile, err)
+		return manifest, nil
+	}
+	return nil, nil
+}
+
+func VerifyArchive(zipfile string) (manifest *Manifest, err error) {
+	defer fail.Around(&err)
+
+	common.TimelineBegin("holotree archive verify %q", zipfile)
+	defer common.TimelineEnd()
+
+	manifest, err = ArchiveManifest(zipfile)
+	fail.On(err != nil, "%v", err)
+	if manifest == nil {
+		pretty.Warning("Archive %q has no manifest, so its content cannot be verified before import.", zipfile)
+		return nil, nil
+	}
+	fail.On(majorVersion(manifest.RccVersion) > majorVersion(common.Version), "Archive %q was made by newer rcc %s, and this is %s.", zipfile, manifest.RccVersion, common.Version)
+	for _, catalog := range manifest.Catalogs {
+		fail.On(catalog.Platform != common.Platform(), "Catalog %q in %q is for platform %q, not for %q.", catalog.Name, zipfile, catalog.Platform, common.Platform())
+		fail.On(catalog.Name != CatalogName(catalog.Blueprint), "Catalog %q in %q is not compatible with this rcc %s.", catalog.Name, zipfile, common.Version)
+	}
+	archive, err := zip.OpenReader(zipfile)
+	fail.On(err != nil, "Could not open %q, reason: %v", zipfile, err)
+	defer archive.Close()
+	seen := make(map[string]bool)
+	for _, entry := range archive.File {
+		if entry.Name == ManifestName || entry.FileInfo().IsDir() {
+			continue
+		}
+		expected, ok := manifest.Checksums[entry.Name]
+		fail.On(!ok, "Entry %q in %q is not listed in manifest.", entry.Name, zipfile)
+		actual, err := zipEntryChecksum(entry)
+		fail.On(err != nil, "Could not read entry %q in %q, reason: %v", entry.Name, zipfile, err)
+		fail.On(actual != expected, "Entry %q in %q is corrupted, expected checksum %s, actual %s.", entry.Name, zipfile, expected, actual)
+		seen[entry.Name] = true
+	}
+	missing := make([]string, 0, 5)
+	for name := range manifest.Checksums {
+		if !seen[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	fail.On(len(missing) > 0, "Archive %q is missing %d entries listed in manifest: %s", zipfile, len(missing), strings.Join(missing, ", "))
+	return manifest, nil
+}
@@ -0,0 +1,70 @@
+package htfs_test
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/hamlet"
+	"github.com/robocorp/rcc/htfs"
+)
+
+func writeArchive(t *testing.T, filename string, manifest *htfs.Manifest, entries map[string]string) {
+	must, _ := hamlet.Specifications(t)
+
+	handle, err := os.Create(filename)
+	must.Nil(err)
+	defer handle.Close()
+	writer := zip.NewWriter(handle)
+	defer writer.Close()
+	for name, content := range entries {
+		sink, err := writer.Create(name)
+		must.Nil(err)
+		_, err = sink.Write([]byte(content))
+		must.Nil(err)
+	}
+	content, err := json.Marshal(manifest)
+	must.Nil(err)
+	sink, err := writer.Create(htfs.ManifestName)
+	must.Nil(err)
+	_, err = sink.Write(content)
+	must.Nil(err)
+}
+
+func TestArchiveManifestIsVerifiedBeforeImport(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	entry := filepath.Join("library", "aa", "bb", "cc", "aabbcc")
+	manifest := &htfs.Manifest{
+		RccVersion: common.Version,
+		Catalogs: []*htfs.ManifestCatalog{
+			{Name: htfs.CatalogName("0123456789abcdef"), Blueprint: "0123456789abcdef", Platform: common.Platform()},
+		},
+		Checksums: map[string]string{
+			entry: fmt.Sprintf("%02x", sha256.Sum256([]byte("object"))),
+		},
+	}
+	directory := t.TempDir()
+
+	good := filepath.Join(directory, "good.zip")
+	writeArchive(t, good, manifest, map[string]string{entry: "object"})
+	found, err := htfs.VerifyArchive(good)
+	must.Nil(err)
+	must.Equal(1, len(found.Catalogs))
+
+	corrupted := filepath.Join(directory, "corrupted.zip")
+	writeArchive(t, corrupted, manifest, map[string]string{entry: "tampered"})
+	_, err = htfs.VerifyArchive(corrupted)
+	wont.Nil(err)
+
+	manifest.Catalogs[0].Platform = "nonexistent_platform"
+	foreign := filepath.Join(directory, "foreign.zip")
+	writeArchive(t, foreign, manifest, map[string]string{entry: "object"})
+	_, err = htfs.VerifyArchive(foreign)
+	wont.Nil(err)
+}
@@ -0,0 +1,464 @@
+package htfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robocorp/rcc/anywork"
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/fail"
+	"github.com/robocorp/rcc/pathlib"
+	"github.com/robocorp/rcc/pretty"
+)
+
+const (
+	packMagic      = "RCCPACK1"
+	packIndexMagic = "RCCIDX01"
+	packEntrySize  = sha256.Size + 16
+	packPrefix     = "pack-"
+)
+
+type packIndex struct {
+	packfile string
+	entries  []byte
+}
+
+type packfiles struct {
+	sync.Mutex
+	modtime time.Time
+	loaded  bool
+	indexes []*packIndex
+}
+
+type packWriter struct {
+	filename string
+	sink     *os.File
+	offset   int64
+	entries  [][]byte
+}
+
+type RepackStats struct {
+	Catalogs uint64
+	Loose    uint64
+	Repacked uint64
+	Dropped  uint64
+	Broken   uint64
+	Objects  uint64
+	Bytes    uint64
+	Packfile string
+}
+
+var (
+	packs = &packfiles{}
+)
+
+func (it *packIndex) count() int {
+	return len(it.entries) / packEntrySize
+}
+
+func (it *packIndex) digestAt(at int) []byte {
+	start := at * packEntrySize
+	return it.entries[start : start+sha256.Size]
+}
+
+func (it *packIndex) lookup(digest []byte) (offset, size int64, ok bool) {
+	count := it.count()
+	at := sort.Search(count, func(index int) bool {
+		return bytes.Compare(it.digestAt(index), digest) >= 0
+	})
+	if at >= count || !bytes.Equal(it.digestAt(at), digest) {
+		return 0, 0, false
+	}
+	entry := it.entries[at*packEntrySize+sha256.Size:]
+	return int64(binary.BigEndian.Uint64(entry)), int64(binary.BigEndian.Uint64(entry[8:])), true
+}
+
+func loadPackIndex(filename string) (index *packIndex, err error) {
+	defer fail.Around(&err)
+
+	content, err := os.ReadFile(filename)
+	fail.On(err != nil, "Could not read pack index %q, reason: %v", filename, err)
+	header := len(packIndexMagic) + 8
+	fail.On(len(content) < header || string(content[:len(packIndexMagic)]) != packIndexMagic, "File %q is not a pack index.", filename)
+	count := binary.BigEndian.Uint64(content[len(packIndexMagic):])
+	body := content[header:]
+	fail.On(uint64(len(body)) != count*packEntrySize, "Pack index %q is truncated, expected %d entries.", filename, count)
+	return &packIndex{
+		packfile: strings.TrimSuffix(filename, ".idx") + ".pack",
+		entries:  body,
+	}, nil
+}
+
+func packIndexFiles() []string {
+	found, err := filepath.Glob(filepath.Join(common.HololibPackLocation(), packPrefix+"*.idx"))
+	if err != nil {
+		return []string{}
+	}
+	sort.Strings(found)
+	return found
+}
+
+func (it *packfiles) current() []*packIndex {
+	it.Lock()
+	defer it.Unlock()
+
+	stat, err := os.Stat(common.HololibPackLocation())
+	if err != nil {
+		it.loaded, it.indexes = false, nil
+		return nil
+	}
+	if it.loaded && stat.ModTime().Equal(it.modtime) {
+		return it.indexes
+	}
+	indexes := make([]*packIndex, 0, 5)
+	for _, filename := range packIndexFiles() {
+		index, err := loadPackIndex(filename)
+		if err != nil {
+			common.Debug("Ignoring pack index, reason: %v", err)
+			continue
+		}
+		indexes = append(indexes, index)
+	}
+	it.modtime, it.loaded, it.indexes = stat.ModTime(), true, indexes
+	return indexes
+}
+
+func (it *packfiles) find(digest string) (packfile string, offset, size int64, ok bool) {
+	raw, err := hex.DecodeString(digest)
+	if err != nil || len(raw) != sha256.Size {
+		return "", 0, 0, false
+	}
+	for _, index := range it.current() {
+		offset, size, ok = index.lookup(raw)
+		if ok {
+			return index.packfile, offset, size, true
+		}
+	}
+	return "", 0, 0, false
+}
+
+func (it *packfiles) forget() {
+	it.Lock()
+	defer it.Unlock()
+
+	it.loaded, it.indexes = false, nil
+}
+
+func IsPacked(digest string) bool {
+	_, _, _, ok := packs.find(digest)
+	return ok
+}
+
+func HasObject(library MutableLibrary, digest string) bool {
+	return pathlib.IsFile(library.ExactLocation(digest)) || IsPacked(digest)
+}
+
+func packedSection(digest string) (section *io.SectionReader, source *os.File, err error) {
+	defer fail.Around(&err)
+
+	packfile, offset, size, ok := packs.find(digest)
+	fail.On(!ok, "Object %q is not in any pack.", digest)
+	source, err = os.Open(packfile)
+	fail.On(err != nil, "Failed to open %q -> %v", packfile, err)
+	return io.NewSectionReader(source, offset, size), source, nil
+}
+
+func packedDelegateOpen(digest string, decompress bool) (readable io.Reader, closer Closer, err error) {
+	defer fail.Around(&err)
+
+	section, source, err := packedSection(digest)
+	fail.On(err != nil, "%v", err)
+
+	var reader io.ReadCloser
+	reader, err = Decompressed(section)
+	if err != nil || !decompress {
+		_, err = section.Seek(0, 0)
+		fail.On(err != nil, "Failed to seek packed %q -> %v", digest, err)
+		reader = io.NopCloser(section)
+	}
+	closer = func() error {
+		reader.Close()
+		return source.Close()
+	}
+	return reader, closer, nil
+}
+
+func zipPacked(digest, relativepath string, sink Zipper) (err error) {
+	defer fail.Around(&err)
+
+	section, source, err := packedSection(digest)
+	fail.On(err != nil, "%v", err)
+	defer source.Close()
+	return sink.AddFrom(section, relativepath)
+}
+
+func packedLibraryHandler(files http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		digest := path.Base(request.URL.Path)
+		if !IsPacked(digest) {
+			files.ServeHTTP(writer, request)
+			return
+		}
+		section, source, err := packedSection(digest)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer source.Close()
+		http.ServeContent(writer, request, digest, motherTime, section)
+	})
+}
+
+func newPackWriter(location string) (writer *packWriter, err error) {
+	defer fail.Around(&err)
+
+	_, err = pathlib.MakeSharedDir(location)
+	fail.On(err != nil, "Could not create pack directory %q, reason: %v", location, err)
+	filename := filepath.Join(location, fmt.Sprintf("%s%x", packPrefix, time.Now().UnixNano()))
+	sink, err := os.Create(filename + ".pack.part")
+	fail.On(err != nil, "Could not create pack %q, reason: %v", filename, err)
+	_, err = sink.Write([]byte(packMagic))
+	fail.On(err != nil, "Could not write pack %q, reason: %v", filename, err)
+	return &packWriter{
+		filename: filename,
+		sink:     sink,
+		offset:   int64(len(packMagic)),
+		entries:  make([][]byte, 0, 1024),
+	}, nil
+}
+
+func (it *packWriter) append(digest string, content []byte) error {
+	raw, err := hex.DecodeString(digest)
+	if err != nil || len(raw) != sha256.Size {
+		return fmt.Errorf("Invalid digest %q for pack.", digest)
+	}
+	_, err = it.sink.Write(content)
+	if err != nil {
+		return err
+	}
+	entry := make([]byte, packEntrySize)
+	copy(entry, raw)
+	binary.BigEndian.PutUint64(entry[sha256.Size:], uint64(it.offset))
+	binary.BigEndian.PutUint64(entry[sha256.Size+8:], uint64(len(content)))
+	it.entries = append(it.entries, entry)
+	it.offset += int64(len(content))
+	return nil
+}
+
+func (it *packWriter) abort() {
+	it.sink.Close()
+	os.Remove(it.filename + ".pack.part")
+}
+
+func (it *packWriter) finish() (err error) {
+	defer fail.Around(&err)
+
+	err = it.sink.Sync()
+	fail.On(err != nil, "Could not sync pack %q, reason: %v", it.filename, err)
+	err = it.sink.Close()
+	fail.On(err != nil, "Could not close pack %q, reason: %v", it.filename, err)
+	sort.Slice(it.entries, func(left, right int) bool {
+		return bytes.Compare(it.entries[left], it.entries[right]) < 0
+	})
+	index := bytes.NewBufferString(packIndexMagic)
+	binary.Write(index, binary.BigEndian, uint64(len(it.entries)))
+	for _, entry := range it.entries {
+		index.Write(entry)
+	}
+	err = os.WriteFile(it.filename+".idx.part", index.Bytes(), 0o644)
+	fail.On(err != nil, "Could not write pack index %q, reason: %v", it.filename, err)
+	err = TryRename("packfile", it.filename+".pack.part", it.filename+".pack")
+	fail.On(err != nil, "%v", err)
+	pathlib.MakeSharedFile(it.filename + ".pack")
+	err = TryRename("packindex", it.filename+".idx.part", it.filename+".idx")
+	fail.On(err != nil, "%v", err)
+	pathlib.MakeSharedFile(it.filename + ".idx")
+	return nil
+}
+
+func readLooseOrPacked(digest string) (content []byte, loose string, err error) {
+	defer fail.Around(&err)
+
+	location := filepath.Join(common.HololibLibraryLocation(), digest[:2], digest[2:4], digest[4:6], digest)
+	if pathlib.IsFile(location) {
+		content, err = os.ReadFile(location)
+		fail.On(err != nil, "Could not read %q, reason: %v", location, err)
+		return content, location, nil
+	}
+	content, err = readPacked(digest)
+	fail.On(err != nil, "%v", err)
+	return content, "", nil
+}
+
+func readPacked(digest string) (content []byte, err error) {
+	defer fail.Around(&err)
+
+	section, source, err := packedSection(digest)
+	fail.On(err != nil, "%v", err)
+	defer source.Close()
+	content, err = io.ReadAll(section)
+	fail.On(err != nil, "Could not read packed %q, reason: %v", digest, err)
+	return content, nil
+}
+
+func verifyContent(digest string, content []byte) error {
+	reader, err := Decompressed(bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	digester := sha256.New()
+	_, err = io.Copy(digester, reader)
+	if err != nil {
+		return err
+	}
+	actual := fmt.Sprintf("%02x", digester.Sum(nil))
+	if actual != digest {
+		return fmt.Errorf("Corrupted object, expected %s, actual %s", digest, actual)
+	}
+	return nil
+}
+
+func verifyPackedWork(digest string, verified func(string)) anywork.Work {
+	return func() {
+		content, err := readPacked(digest)
+		if err == nil {
+			err = verifyContent(digest, content)
+		}
+		if err != nil {
+			common.Debug("Packed object %s failed verification, reason: %v", digest, err)
+			return
+		}
+		verified(digest)
+	}
+}
+
+func VerifyPacked(needed map[string]map[string]bool) error {
+	var guard sync.Mutex
+	verified := make([]string, 0, len(needed))
+	for _, index := range packs.current() {
+		for at := 0; at < index.count(); at++ {
+			digest := fmt.Sprintf("%02x", index.digestAt(at))
+			if _, ok := needed[digest]; !ok {
+				continue
+			}
+			anywork.Backlog(verifyPackedWork(digest, func(digest string) {
+				guard.Lock()
+				defer guard.Unlock()
+				verified = append(verified, digest)
+			}))
+		}
+	}
+	err := anywork.Sync()
+	for _, digest := range verified {
+		delete(needed, digest)
+	}
+	return err
+}
+
+func Repack() (stats *RepackStats, err error) {
+	defer fail.Around(&err)
+
+	common.TimelineBegin("holotree repack start")
+	defer common.TimelineEnd()
+
+	completed := pathlib.LockWaitMessage("Serialized holotree repack [holotree lock]")
+	locker, err := pathlib.Locker(common.HolotreeLock(), 30000)
+	completed()
+	fail.On(err != nil, "Could not get lock for holotree. Quiting.")
+	defer locker.Release()
+
+	marked, catalogs, err := MarkReferencedDigests()
+	fail.On(err != nil, "%v", err)
+	stats = &RepackStats{Catalogs: uint64(catalogs)}
+	digests := make([]string, 0, len(marked))
+	for digest := range marked {
+		digests = append(digests, digest)
+	}
+	sort.Strings(digests)
+
+	packs.forget()
+	previous := packs.current()
+	for _, index := range previous {
+		for at := 0; at < index.count(); at++ {
+			if !marked[fmt.Sprintf("%02x", index.digestAt(at))] {
+				stats.Dropped += 1
+			}
+		}
+	}
+
+	leftovers, _ := filepath.Glob(filepath.Join(common.HololibPackLocation(), "*.part"))
+	for _, leftover := range leftovers {
+		os.Remove(leftover)
+	}
+
+	writer, err := newPackWriter(common.HololibPackLocation())
+	fail.On(err != nil, "%v", err)
+	loose := make([]string, 0, len(digests))
+	for _, digest := range digests {
+		content, location, err := readLooseOrPacked(digest)
+		if err == nil {
+			err = verifyContent(digest, content)
+		}
+		if err != nil {
+			stats.Broken += 1
+			common.Debug("Not repacking object %s, reason: %v", digest, err)
+			continue
+		}
+		err = writer.append(digest, content)
+		if err != nil {
+			writer.abort()
+			fail.On(true, "Could not append %s to pack, reason: %v", digest, err)
+		}
+		if len(location) > 0 {
+			loose = append(loose, location)
+			stats.Loose += 1
+		} else {
+			stats.Repacked += 1
+		}
+		stats.Objects += 1
+		stats.Bytes += uint64(len(content))
+	}
+	if len(writer.entries) > 0 {
+		err = writer.finish()
+		fail.On(err != nil, "%v", err)
+		stats.Packfile = writer.filename + ".pack"
+	} else {
+		writer.abort()
+	}
+	if stats.Broken > 0 {
+		pretty.Warning("%d referenced objects were missing or corrupted and were not packed. Run 'rcc holotree check' to fix.", stats.Broken)
+	}
+
+	for _, index := range previous {
+		anywork.Backlog(RemoveFile(strings.TrimSuffix(index.packfile, ".pack") + ".idx"))
+	}
+	err = anywork.Sync()
+	fail.On(err != nil, "Removing old pack indexes failed, reason: %v", err)
+	for _, index := range previous {
+		anywork.Backlog(RemoveFile(index.packfile))
+	}
+	for _, location := range loose {
+		anywork.Backlog(RemoveFile(location))
+	}
+	err = anywork.Sync()
+	fail.On(err != nil, "Removing repacked objects failed, reason: %v", err)
+	packs.forget()
+	if pathlib.IsDir(common.HololibLibraryLocation()) {
+		err = pathlib.RemoveEmptyDirectores(common.HololibLibraryLocation())
+		fail.On(err != nil, "%v", err)
+	}
+	return stats, nil
+}
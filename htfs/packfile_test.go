@@ -0,0 +1,59 @@
+package htfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/robocorp/rcc/hamlet"
+	"github.com/robocorp/rcc/pathlib"
+)
+
+func packedObject(text string) (string, []byte) {
+	var sink bytes.Buffer
+	writer, _ := zstdCodec(0).Writer(&sink)
+	writer.Write([]byte(text))
+	writer.Close()
+	return fmt.Sprintf("%02x", sha256.Sum256([]byte(text))), sink.Bytes()
+}
+
+func TestPackWriterCreatesSearchableIndex(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	writer, err := newPackWriter(t.TempDir())
+	must.Nil(err)
+	objects := map[string][]byte{}
+	for _, text := range []string{"alpha", "beta", "gamma", "delta"} {
+		digest, content := packedObject(text)
+		objects[digest] = content
+		must.Nil(writer.append(digest, content))
+	}
+	wont.Nil(writer.append("nothex", []byte("x")))
+	must.Nil(writer.finish())
+	wont.True(pathlib.Exists(writer.filename + ".pack.part"))
+
+	index, err := loadPackIndex(writer.filename + ".idx")
+	must.Nil(err)
+	must.Equal(4, index.count())
+	must.Equal(writer.filename+".pack", index.packfile)
+
+	pack, err := os.ReadFile(index.packfile)
+	must.Nil(err)
+	must.Equal(packMagic, string(pack[:len(packMagic)]))
+	for digest, content := range objects {
+		raw, _ := hex.DecodeString(digest)
+		offset, size, ok := index.lookup(raw)
+		must.True(ok)
+		stored := pack[offset : offset+size]
+		must.Equal(content, stored)
+		must.Nil(verifyContent(digest, stored))
+	}
+	missing, _ := packedObject("missing")
+	raw, _ := hex.DecodeString(missing)
+	_, _, ok := index.lookup(raw)
+	wont.True(ok)
+	wont.Nil(verifyContent(missing, objects[fmt.Sprintf("%02x", sha256.Sum256([]byte("alpha")))]))
+}
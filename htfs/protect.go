@@ -0,0 +1,116 @@
+package htfs
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/robocorp/rcc/anywork"
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/settings"
+)
+
+const (
+	writeBits fs.FileMode = 0o222
+)
+
+func ProtectSpaces() bool {
+	return settings.Global.ProtectSpaces() && !common.Liveonly && runtime.GOOS != "windows"
+}
+
+// ProtectedSpace tells if space in targetdir was left read-only by its
+// last restore.
+func ProtectedSpace(targetdir string) bool {
+	shadow, err := NewRoot(targetdir)
+	if err != nil {
+		return false
+	}
+	return shadow.LoadHeaderFrom(targetdir+".meta") == nil && shadow.Protected
+}
+
+func chmodEntry(fullpath string, mode fs.FileMode) {
+	err := os.Chmod(fullpath, mode)
+	if err != nil && !os.IsNotExist(err) {
+		anywork.OnErrPanicCloseAll(err)
+	}
+}
+
+func ProtectDirectory(library Library) Dirtask {
+	hardlinks := linkingLibrary(library) && RestoreMode() == RestoreHardlink
+	return func(path string, it *Dir) anywork.Work {
+		return func() {
+			if it.Shadow || it.IsSymlink() {
+				return
+			}
+			for name, details := range it.Files {
+				// hardlinked files are shared with hololib, so they are left as is
+				if details.IsSymlink() || (hardlinks && linkable(details)) {
+					continue
+				}
+				chmodEntry(filepath.Join(path, name), details.Mode&^writeBits)
+			}
+			chmodEntry(path, it.Mode&^writeBits)
+		}
+	}
+}
+
+func UnprotectDirectory(path string, it *Dir) anywork.Work {
+	return func() {
+		if it.Shadow || it.IsSymlink() {
+			return
+		}
+		chmodEntry(path, it.Mode|0o200)
+		for name, details := range it.Files {
+			if !details.IsSymlink() {
+				chmodEntry(filepath.Join(path, name), details.Mode)
+			}
+		}
+	}
+}
+
+// liftProtection makes directories under target writable again, so that
+// their content can be removed.
+func liftProtection(target string) {
+	filepath.WalkDir(target, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && entry.IsDir() {
+			info, err := entry.Info()
+			if err == nil && info.Mode()&0o200 == 0 {
+				os.Chmod(path, info.Mode()|0o200)
+			}
+		}
+		return nil
+	})
+}
+
+func unprotectSpace(previous *Root) {
+	if previous == nil || !previous.Protected {
+		return
+	}
+	common.TimelineBegin("holotree unprotect start %q", previous.Path)
+	defer common.TimelineEnd()
+	err := previous.AllDirs(UnprotectDirectory)
+	if err != nil {
+		common.Debug("Could not lift protection of %q, reason: %v", previous.Path, err)
+	}
+	previous.Protected = false
+}
+
+func protectSpace(library Library, fs *Root) error {
+	fs.Protected = ProtectSpaces()
+	if !fs.Protected {
+		return nil
+	}
+	common.TimelineBegin("holotree protect start %q", fs.Path)
+	defer common.TimelineEnd()
+	return fs.AllDirs(ProtectDirectory(library))
+}
+
+// protecting lifts protection from previous space content and returns
+// function which protects restored space, when protection is enabled.
+func protecting(library Library, previous *Root) func(*Root) error {
+	unprotectSpace(previous)
+	return func(fs *Root) error {
+		return protectSpace(library, fs)
+	}
+}
@@ -0,0 +1,54 @@
+package htfs
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/robocorp/rcc/hamlet"
+)
+
+func modeOf(filename string) os.FileMode {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return 0
+	}
+	return info.Mode().Perm()
+}
+
+func TestProtectionCanBeLiftedAndRestored(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("space protection is not used on windows")
+	}
+	must, _ := hamlet.Specifications(t)
+
+	space := filepath.Join(t.TempDir(), "space")
+	must.Nil(os.MkdirAll(filepath.Join(space, "lib"), 0o755))
+	must.Nil(os.WriteFile(filepath.Join(space, "lib", "module.py"), []byte("pass"), 0o644))
+	must.Nil(os.WriteFile(filepath.Join(space, "run.sh"), []byte("true"), 0o755))
+
+	fs, err := NewRoot(space)
+	must.Nil(err)
+	must.Nil(fs.Lift())
+
+	fs.Protected = true
+	must.Nil(fs.AllDirs(ProtectDirectory(nil)))
+	must.Equal(os.FileMode(0o555), modeOf(space))
+	must.Equal(os.FileMode(0o555), modeOf(filepath.Join(space, "lib")))
+	must.Equal(os.FileMode(0o444), modeOf(filepath.Join(space, "lib", "module.py")))
+	must.Equal(os.FileMode(0o555), modeOf(filepath.Join(space, "run.sh")))
+
+	unprotectSpace(fs)
+	must.Equal(false, fs.Protected)
+	must.Equal(os.FileMode(0o755), modeOf(space))
+	must.Equal(os.FileMode(0o755), modeOf(filepath.Join(space, "lib")))
+	must.Equal(os.FileMode(0o644), modeOf(filepath.Join(space, "lib", "module.py")))
+	must.Equal(os.FileMode(0o755), modeOf(filepath.Join(space, "run.sh")))
+
+	must.Nil(fs.AllDirs(ProtectDirectory(nil)))
+	liftProtection(space)
+	must.Equal(os.FileMode(0o755), modeOf(filepath.Join(space, "lib")))
+	must.Equal(os.FileMode(0o444), modeOf(filepath.Join(space, "lib", "module.py")))
+	must.Nil(TryRemoveAll("space", space))
+}
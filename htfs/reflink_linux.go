@@ -0,0 +1,24 @@
+//go:build linux
+// +build linux
+
+package htfs
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func cloneFile(source, target string) error {
+	reader, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	writer, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+	return unix.IoctlFileClone(int(writer.Fd()), int(reader.Fd()))
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package htfs
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func cloneFile(source, target string) error {
+	return fmt.Errorf("Reflinks are not supported on %s.", runtime.GOOS)
+}
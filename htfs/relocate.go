@@ -0,0 +1,214 @@
+package htfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/robocorp/rcc/anywork"
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/pathlib"
+	"github.com/robocorp/rcc/pretty"
+)
+
+type relocation struct {
+	sync.Mutex
+	source   string
+	target   string
+	identity []byte
+	variants [][2][]byte
+	refused  []string
+}
+
+func pathVariants(path string) []string {
+	result := []string{path}
+	seen := map[string]bool{path: true}
+	for _, variant := range []string{filepath.ToSlash(path), strings.ReplaceAll(path, `\`, `\\`)} {
+		if !seen[variant] {
+			seen[variant] = true
+			result = append(result, variant)
+		}
+	}
+	return result
+}
+
+func newRelocation(source, target string) *relocation {
+	sources := pathVariants(source)
+	targets := pathVariants(target)
+	variants := make([][2][]byte, 0, len(sources))
+	for at, variant := range sources {
+		replacement := targets[len(targets)-1]
+		if at < len(targets) {
+			replacement = targets[at]
+		}
+		variants = append(variants, [2][]byte{[]byte(variant), []byte(replacement)})
+	}
+	return &relocation{
+		source:   source,
+		target:   target,
+		identity: []byte(filepath.Base(source)),
+		variants: variants,
+		refused:  make([]string, 0, 10),
+	}
+}
+
+func (it *relocation) refuse(filename, reason string) {
+	it.Lock()
+	defer it.Unlock()
+	it.refused = append(it.refused, fmt.Sprintf("%s (%s)", filename, reason))
+}
+
+func (it *relocation) replace(content []byte) []byte {
+	for _, variant := range it.variants {
+		content = bytes.ReplaceAll(content, variant[0], variant[1])
+	}
+	return content
+}
+
+func (it *relocation) text(content []byte) ([]byte, bool) {
+	result := it.replace(content)
+	return result, !bytes.Contains(result, it.identity)
+}
+
+func (it *relocation) binary(content []byte) ([]byte, bool) {
+	result := make([]byte, len(content))
+	copy(result, content)
+	cursor := 0
+	for {
+		found := bytes.Index(result[cursor:], it.identity)
+		if found < 0 {
+			return result, true
+		}
+		start := cursor + found
+		for start > 0 && result[start-1] != 0 {
+			start--
+		}
+		end := bytes.IndexByte(result[start:], 0)
+		if end < 0 {
+			return content, false
+		}
+		end += start
+		segment := it.replace(result[start:end])
+		if len(segment) > end-start || bytes.Contains(segment, it.identity) {
+			return content, false
+		}
+		copy(result[start:end], segment)
+		for at := start + len(segment); at < end; at++ {
+			result[at] = 0
+		}
+		cursor = end
+	}
+}
+
+func (it *relocation) Relocate(content []byte) ([]byte, bool, bool) {
+	if bytes.IndexByte(content, 0) < 0 {
+		result, ok := it.text(content)
+		return result, ok, false
+	}
+	result, ok := it.binary(content)
+	return result, ok, true
+}
+
+func (it *relocation) Report() error {
+	it.Lock()
+	defer it.Unlock()
+	if len(it.refused) == 0 {
+		return nil
+	}
+	sort.Strings(it.refused)
+	for _, entry := range it.refused {
+		pretty.Warning("Could not relocate %s", entry)
+	}
+	return fmt.Errorf("%d files could not be relocated from %q to %q. Try shorter target path.", len(it.refused), it.source, it.target)
+}
+
+func TargetedSpace() bool {
+	return len(common.HolotreeTarget) > 0
+}
+
+func SpaceFiles(basedir, name string) (metafile, targetdir, lockfile string) {
+	targetdir = filepath.Join(basedir, name)
+	if TargetedSpace() {
+		targetdir = common.HolotreeTarget
+		if fullpath, err := filepath.Abs(targetdir); err == nil {
+			targetdir = fullpath
+		}
+		pathlib.EnsureDirectory(filepath.Dir(targetdir))
+	}
+	return targetdir + ".meta", targetdir, targetdir + ".lck"
+}
+
+func relocateSpace(fs, shadow *Root, targetdir string) error {
+	if !TargetedSpace() && len(fs.Adopted) == 0 {
+		return fs.Relocate(targetdir)
+	}
+	if shadow != nil {
+		adoptRelocatedSizes(fs.Tree, shadow.Tree)
+	}
+	if len(fs.Adopted) > 0 {
+		return fs.RelocateAdopted(targetdir)
+	}
+	return fs.RelocateAnywhere(targetdir)
+}
+
+func adoptRelocatedSizes(target, shadow *Dir) {
+	if target == nil || shadow == nil {
+		return
+	}
+	for name, file := range target.Files {
+		previous, ok := shadow.Files[name]
+		if ok && len(file.Rewrite) > 0 && previous.Digest == file.Digest {
+			file.Size = previous.Size
+		}
+	}
+	for name, subdir := range target.Dirs {
+		adoptRelocatedSizes(subdir, shadow.Dirs[name])
+	}
+}
+
+func RelocateFile(library Library, relocation *relocation, digest, sinkname string, details *File) anywork.Work {
+	return func() {
+		reader, closer, err := library.Open(digest)
+		anywork.OnErrPanicCloseAll(err)
+		defer closer()
+
+		digester := sha256.New()
+		content, err := io.ReadAll(io.TeeReader(reader, digester))
+		anywork.OnErrPanicCloseAll(err)
+
+		hexdigest := fmt.Sprintf("%02x", digester.Sum(nil))
+		if digest != hexdigest {
+			anywork.OnErrPanicCloseAll(fmt.Errorf("Corrupted hololib, expected %s, actual %s", digest, hexdigest))
+		}
+
+		relocated, ok, binary := relocation.Relocate(content)
+		if !ok && binary {
+			relocation.refuse(sinkname, "binary file, target path is longer or string is not terminated")
+		}
+		if !ok && !binary {
+			relocation.refuse(sinkname, "text file, contains references outside of full space path")
+		}
+		if !ok {
+			// leaving file out keeps it dirty, so it is not mistaken as restored
+			err = os.Remove(sinkname)
+			if err != nil && !os.IsNotExist(err) {
+				anywork.OnErrPanicCloseAll(err)
+			}
+			return
+		}
+
+		partname := fmt.Sprintf("%s.part%s", sinkname, <-common.Identities)
+		defer os.Remove(partname)
+		anywork.OnErrPanicCloseAll(os.WriteFile(partname, relocated, 0o600))
+		anywork.OnErrPanicCloseAll(TryRename("relocate", partname, sinkname))
+		anywork.OnErrPanicCloseAll(os.Chmod(sinkname, details.Mode))
+		anywork.OnErrPanicCloseAll(os.Chtimes(sinkname, motherTime, motherTime))
+		details.Size = int64(len(relocated))
+	}
+}
@@ -0,0 +1,69 @@
+package htfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/robocorp/rcc/anywork"
+	"github.com/robocorp/rcc/hamlet"
+	"github.com/robocorp/rcc/pathlib"
+)
+
+func TestRelocationRewritesTextAndPadsBinary(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	shorter := newRelocation("/home/user/holotree/h1234_abcdeft", "/opt/env")
+	text, ok, binary := shorter.Relocate([]byte("#!/home/user/holotree/h1234_abcdeft/bin/python\n"))
+	must.True(ok)
+	wont.True(binary)
+	must.Equal("#!/opt/env/bin/python\n", string(text))
+
+	original := []byte("\x7fELF\x00/home/user/holotree/h1234_abcdeft/lib\x00tail\x00")
+	padded, ok, binary := shorter.Relocate(original)
+	must.True(ok)
+	must.True(binary)
+	must.Equal(len(original), len(padded))
+	must.True(bytes.HasPrefix(padded, []byte("\x7fELF\x00/opt/env/lib\x00\x00")))
+	must.True(bytes.HasSuffix(padded, []byte("\x00tail\x00")))
+
+	_, ok, _ = shorter.Relocate([]byte("relative h1234_abcdeft reference\n"))
+	wont.True(ok)
+
+	longer := newRelocation("/home/user/holotree/h1234_abcdeft", "/opt/robots/a/much/longer/environment/path")
+	refused, ok, binary := longer.Relocate(original)
+	wont.True(ok)
+	must.True(binary)
+	must.Equal(string(original), string(refused))
+	must.Nil(shorter.Report())
+	longer.refuse("lib.so", "binary")
+	wont.Nil(longer.Report())
+}
+
+func TestRefusedRelocationLeavesFileMissing(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	t.Setenv("ROBOCORP_HOME", t.TempDir())
+	library, err := New()
+	must.Nil(err)
+	content := []byte("\x7fELF\x00/home/user/holotree/h1234_abcdeft/lib\x00")
+	digest := fmt.Sprintf("%02x", sha256.Sum256(content))
+	source := filepath.Join(t.TempDir(), "binary.so")
+	must.Nil(os.WriteFile(source, content, 0o644))
+	_, err = pathlib.MakeSharedDir(library.Location(digest))
+	must.Nil(err)
+	anywork.Backlog(LiftFile(source, library.ExactLocation(digest)))
+	must.Nil(anywork.Sync())
+
+	sinkname := filepath.Join(t.TempDir(), "binary.so")
+	must.Nil(os.WriteFile(sinkname, content, 0o644))
+	details := &File{Name: "binary.so", Size: int64(len(content)), Mode: 0o644, Digest: digest, Rewrite: []int64{11}}
+	longer := newRelocation("/home/user/holotree/h1234_abcdeft", "/opt/robots/a/much/longer/environment/path")
+	anywork.Backlog(RelocateFile(library, longer, digest, sinkname, details))
+	must.Nil(anywork.Sync())
+	wont.Nil(longer.Report())
+	wont.True(pathlib.IsFile(sinkname))
+}
@@ -0,0 +1,288 @@
+package htfs
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/robocorp/rcc/anywork"
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/fail"
+	"github.com/robocorp/rcc/pathlib"
+	"github.com/robocorp/rcc/settings"
+)
+
+const (
+	remoteProbeTimeout    = 10 * time.Second
+	remoteDownloadTimeout = 10 * time.Minute
+)
+
+type remotelib struct {
+	base   string
+	local  MutableLibrary
+	client *http.Client
+	probe  *http.Client
+	known  map[string]bool
+}
+
+func RemoteLibraryURL() string {
+	return strings.TrimSpace(settings.Global.HolotreeRemoteLibrary())
+}
+
+// RemoteLibrary uses short timeout for probes and other small requests, since
+// those are made while holding holotree locks, and long one for downloads.
+func RemoteLibrary(base string, local MutableLibrary) Library {
+	transport := settings.Global.ConfiguredHttpTransport()
+	return &remotelib{
+		base:  strings.TrimRight(base, "/"),
+		local: local,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   remoteDownloadTimeout,
+		},
+		probe: &http.Client{
+			Transport: transport,
+			Timeout:   remoteProbeTimeout,
+		},
+		known: make(map[string]bool),
+	}
+}
+
+func (it *remotelib) link(parts ...string) string {
+	return strings.Join(append([]string{it.base}, parts...), "/")
+}
+
+func (it *remotelib) catalogLink(key string) string {
+	return it.link("catalog", CatalogName(key))
+}
+
+func (it *remotelib) objectLink(digest string) string {
+	return it.link("library", digest[:2], digest[2:4], digest[4:6], digest)
+}
+
+func (it *remotelib) signatures(key string) []byte {
+	if SignaturePolicy() == SignatureOff {
+		return nil
+	}
+	response, err := it.probe.Get(it.link("signatures", fmt.Sprintf("%s.sig", CatalogName(key))))
+	if err != nil {
+		return nil
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil
+	}
+	content, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil
+	}
+	return content
+}
+
+func (it *remotelib) fetch(link, filename string) (err error) {
+	defer fail.Around(&err)
+
+	response, err := it.client.Get(link)
+	fail.On(err != nil, "Remote hololib request %q failed, reason: %v", link, err)
+	defer response.Body.Close()
+	fail.On(response.StatusCode != http.StatusOK, "Remote hololib request %q failed, reason: %s", link, response.Status)
+	sink, err := os.Create(filename)
+	fail.On(err != nil, "Could not create %q, reason: %v", filename, err)
+	defer sink.Close()
+	_, err = io.Copy(sink, response.Body)
+	fail.On(err != nil, "Remote hololib download %q failed, reason: %v", link, err)
+	return sink.Sync()
+}
+
+func verifyObject(filename, digest string) (err error) {
+	defer fail.Around(&err)
+
+	source, err := os.Open(filename)
+	fail.On(err != nil, "Could not open %q, reason: %v", filename, err)
+	defer source.Close()
+	reader, err := Decompressed(source)
+	fail.On(err != nil, "Could not decompress %q, reason: %v", filename, err)
+	defer reader.Close()
+	digester := sha256.New()
+	_, err = io.Copy(digester, reader)
+	fail.On(err != nil, "Could not read %q, reason: %v", filename, err)
+	actual := fmt.Sprintf("%02x", digester.Sum(nil))
+	fail.On(actual != digest, "Corrupted remote hololib object, expected %s, actual %s", digest, actual)
+	return nil
+}
+
+func (it *remotelib) pullObject(digest string) (err error) {
+	defer fail.Around(&err)
+
+	sinkname := it.local.ExactLocation(digest)
+	if HasObject(it.local, digest) {
+		return nil
+	}
+	_, err = pathlib.MakeSharedDir(it.local.Location(digest))
+	fail.On(err != nil, "Could not create %q, reason: %v", it.local.Location(digest), err)
+	partname := fmt.Sprintf("%s.part%s", sinkname, <-common.Identities)
+	defer os.Remove(partname)
+	err = it.fetch(it.objectLink(digest), partname)
+	fail.On(err != nil, "%v", err)
+	err = verifyObject(partname, digest)
+	fail.On(err != nil, "%v", err)
+	err = TryRename("remotefile", partname, sinkname)
+	fail.On(err != nil, "%v", err)
+	pathlib.MakeSharedFile(sinkname)
+	return nil
+}
+
+func pullObjectWork(it *remotelib, digest string) anywork.Work {
+	return func() {
+		anywork.OnErrPanicCloseAll(it.pullObject(digest))
+	}
+}
+
+func scheduleRemotePulls(it *remotelib, stats *stats) Treetop {
+	var scheduler Treetop
+	seen := make(map[string]bool)
+	scheduler = func(path string, dir *Dir) error {
+		if dir.IsSymlink() {
+			return nil
+		}
+		for name, subdir := range dir.Dirs {
+			scheduler(filepath.Join(path, name), subdir)
+		}
+		for _, file := range dir.Files {
+			if file.IsSymlink() || seen[file.Digest] {
+				continue
+			}
+			seen[file.Digest] = true
+			missing := !HasObject(it.local, file.Digest)
+			stats.Dirty(missing)
+			if !missing {
+				continue
+			}
+			anywork.Backlog(pullObjectWork(it, file.Digest))
+		}
+		return nil
+	}
+	return scheduler
+}
+
+func (it *remotelib) Pull(blueprint []byte) (err error) {
+	defer fail.Around(&err)
+	defer common.Stopwatch("Remote hololib pull took:").Debug()
+
+	key := BlueprintHash(blueprint)
+	common.TimelineBegin("holotree remote pull start [%s]", key)
+	defer common.TimelineEnd()
+	catalog := catalogFile(key)
+	partname := filepath.Join(filepath.Dir(catalog), fmt.Sprintf("remote_%s.part%s", key, <-common.Identities))
+	defer os.Remove(partname)
+	err = it.fetch(it.catalogLink(key), partname)
+	fail.On(err != nil, "%v", err)
+	signatures := it.signatures(key)
+	content, err := os.ReadFile(partname)
+	fail.On(err != nil, "Failed to read remote catalog %q -> %v", key, err)
+	err = applySignaturePolicy(CatalogName(key), content, signatures)
+	fail.On(err != nil, "%v", err)
+	fs, err := NewRoot(".")
+	fail.On(err != nil, "Failed to create root -> %v", err)
+	err = fs.LoadFrom(partname)
+	fail.On(err != nil, "Failed to load remote catalog %q -> %v", key, err)
+	fail.On(fs.Blueprint != key, "Remote catalog blueprint mismatch, expected %q, actual %q", key, fs.Blueprint)
+	fail.On(fs.Platform != common.Platform(), "Remote catalog platform mismatch, expected %q, actual %q", common.Platform(), fs.Platform)
+	base := filepath.Dir(it.local.Stage())
+	fail.On(fs.HolotreeBase() != base, "Remote catalog holotree location mismatch, expected %q, actual %q", base, fs.HolotreeBase())
+	score := &stats{}
+	err = fs.Treetop(scheduleRemotePulls(it, score))
+	fail.On(err != nil, "Failed to pull objects for %q -> %v", key, err)
+	common.Timeline("- pulled %d/%d", score.dirty, score.total)
+	common.Debug("Remote hololib pulled %d out of %d objects.", score.dirty, score.total)
+	runtime.Gosched()
+	if len(signatures) > 0 {
+		location := SignatureLocation(catalog)
+		pathlib.MakeSharedDir(filepath.Dir(location))
+		err = os.WriteFile(location, signatures, 0o644)
+		fail.On(err != nil, "Failed to save signature %q -> %v", location, err)
+		pathlib.MakeSharedFile(location)
+	}
+	err = TryRename("remotecatalog", partname, catalog)
+	fail.On(err != nil, "%v", err)
+	pathlib.MakeSharedFile(catalog)
+	forgetBlueprint(it.local, key)
+	return nil
+}
+
+func (it *remotelib) ValidateBlueprint(blueprint []byte) error {
+	return nil
+}
+
+func (it *remotelib) HasBlueprint(blueprint []byte) bool {
+	key := BlueprintHash(blueprint)
+	found, ok := it.known[key]
+	if ok {
+		return found
+	}
+	response, err := it.probe.Head(it.catalogLink(key))
+	if err != nil {
+		common.Debug("Remote hololib query failed, reason: %v", err)
+	}
+	found = err == nil && response.StatusCode == http.StatusOK
+	if response != nil {
+		response.Body.Close()
+	}
+	it.known[key] = found
+	return found
+}
+
+func (it *remotelib) Open(digest string) (readable io.Reader, closer Closer, err error) {
+	err = it.pullObject(digest)
+	if err != nil {
+		return nil, nil, err
+	}
+	return it.local.Open(digest)
+}
+
+func (it *remotelib) TargetDir(blueprint, client, tag []byte) (string, error) {
+	return it.local.TargetDir(blueprint, client, tag)
+}
+
+func (it *remotelib) Restore(blueprint, client, tag []byte) (string, error) {
+	if !pathlib.IsFile(it.local.CatalogPath(BlueprintHash(blueprint))) {
+		err := it.Pull(blueprint)
+		if err != nil {
+			return "", err
+		}
+	}
+	return it.local.Restore(blueprint, client, tag)
+}
+
+// filesOnly hides directories, so that served hololib cannot be listed.
+type filesOnly struct {
+	http.FileSystem
+}
+
+func (it filesOnly) Open(name string) (http.File, error) {
+	file, err := it.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		file.Close()
+		return nil, os.ErrNotExist
+	}
+	return file, nil
+}
+
+func HololibHandler() http.Handler {
+	files := http.FileServer(filesOnly{http.Dir(common.HololibLocation())})
+	mux := http.NewServeMux()
+	mux.Handle("/catalog/", files)
+	mux.Handle("/library/", packedLibraryHandler(files))
+	mux.Handle("/signatures/", files)
+	return mux
+}
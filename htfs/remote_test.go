@@ -0,0 +1,81 @@
+package htfs
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/robocorp/rcc/anywork"
+	"github.com/robocorp/rcc/hamlet"
+	"github.com/robocorp/rcc/pathlib"
+)
+
+func TestRemoteLibraryPullsOnlyMissingObjects(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	t.Setenv("ROBOCORP_HOME", t.TempDir())
+	served, err := New()
+	must.Nil(err)
+	content := []byte("remote content\n")
+	digest := fmt.Sprintf("%02x", sha256.Sum256(content))
+	source := filepath.Join(t.TempDir(), "source.txt")
+	must.Nil(os.WriteFile(source, content, 0o644))
+	_, err = pathlib.MakeSharedDir(served.Location(digest))
+	must.Nil(err)
+	anywork.Backlog(LiftFile(source, served.ExactLocation(digest)))
+	must.Nil(anywork.Sync())
+
+	requests := int32(0)
+	handler := HololibHandler()
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		handler.ServeHTTP(writer, request)
+	}))
+	defer server.Close()
+
+	listing, err := http.Get(server.URL + "/library/")
+	must.Nil(err)
+	listing.Body.Close()
+	must.Equal(http.StatusNotFound, listing.StatusCode)
+
+	t.Setenv("ROBOCORP_HOME", t.TempDir())
+	local, err := New()
+	must.Nil(err)
+	remote := RemoteLibrary(server.URL, local).(*remotelib)
+	must.Equal(remoteProbeTimeout, remote.probe.Timeout)
+	must.Equal(remoteDownloadTimeout, remote.client.Timeout)
+	wont.True(HasObject(local, digest))
+
+	fs := &Root{Tree: newDir("", "", false)}
+	fs.Tree.Files["source.txt"] = &File{Name: "source.txt", Size: int64(len(content)), Mode: 0o644, Digest: digest, Rewrite: []int64{}}
+	score := &stats{}
+	must.Nil(fs.Treetop(scheduleRemotePulls(remote, score)))
+	must.Nil(anywork.Sync())
+	must.Equal(uint64(1), score.dirty)
+	must.True(HasObject(local, digest))
+	before := atomic.LoadInt32(&requests)
+
+	score = &stats{}
+	must.Nil(fs.Treetop(scheduleRemotePulls(remote, score)))
+	must.Nil(anywork.Sync())
+	must.Equal(uint64(0), score.dirty)
+	must.Equal(before, atomic.LoadInt32(&requests))
+
+	// lazy open pulls object into fresh hololib too
+	t.Setenv("ROBOCORP_HOME", t.TempDir())
+	fresh, err := New()
+	must.Nil(err)
+	remote = RemoteLibrary(server.URL, fresh).(*remotelib)
+	reader, closer, err := remote.Open(digest)
+	must.Nil(err)
+	pulled, err := io.ReadAll(reader)
+	must.Nil(closer())
+	must.Nil(err)
+	must.Equal(content, pulled)
+}
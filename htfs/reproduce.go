@@ -0,0 +1,158 @@
+package htfs
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/conda"
+	"github.com/robocorp/rcc/fail"
+	"github.com/robocorp/rcc/pathlib"
+)
+
+const (
+	ReproducePyc       = "pyc"
+	ReproduceRecord    = "record"
+	ReproduceTimestamp = "timestamp"
+	ReproduceContent   = "content"
+
+	firstBuildSuffix = ".first"
+)
+
+var (
+	timestampPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`\d{4}-\d{2}-\d{2}([T ]\d{2}:\d{2}(:\d{2}(\.\d+)?)?(Z|[+-]\d{2}:?\d{2})?)?`),
+		regexp.MustCompile(`\d{1,2}:\d{2}:\d{2}(\.\d+)?`),
+		regexp.MustCompile(`\b1[0-9]{9}(\.[0-9]+)?\b`),
+	}
+	timestampMarker = []byte("<timestamp>")
+)
+
+type Irreproducible struct {
+	*Difference
+	Class string `json:"class"`
+}
+
+type Irreproducibles []*Irreproducible
+
+func (it Irreproducibles) Count(class string) int {
+	total := 0
+	for _, entry := range it {
+		if entry.Class == class {
+			total += 1
+		}
+	}
+	return total
+}
+
+type Reproduction struct {
+	Blueprint string                    `json:"blueprint"`
+	Files     Irreproducibles           `json:"files"`
+	Packages  []*conda.DependencyChange `json:"packages"`
+}
+
+func (it *Reproduction) Reproducible() bool {
+	return len(it.Files) == 0 && len(it.Packages) == 0
+}
+
+func withoutTimestamps(content []byte) []byte {
+	for _, pattern := range timestampPatterns {
+		content = pattern.ReplaceAll(content, timestampMarker)
+	}
+	return content
+}
+
+func onlyTimestampsDiffer(before, after string) bool {
+	left, err := os.ReadFile(before)
+	if err != nil {
+		return false
+	}
+	right, err := os.ReadFile(after)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(withoutTimestamps(left), withoutTimestamps(right))
+}
+
+func classifyDifference(first, second string, delta *Difference) string {
+	name := filepath.Base(delta.Path)
+	parent := filepath.Base(filepath.Dir(delta.Path))
+	switch {
+	case filepath.Ext(name) == ".pyc" || parent == "__pycache__":
+		return ReproducePyc
+	case name == "RECORD" && strings.HasSuffix(parent, ".dist-info"):
+		return ReproduceRecord
+	case delta.Status != DiffChanged || delta.Before.Kind != "file" || len(delta.Before.Symlink) > 0:
+		return ReproduceContent
+	case onlyTimestampsDiffer(filepath.Join(first, delta.Path), filepath.Join(second, delta.Path)):
+		return ReproduceTimestamp
+	default:
+		return ReproduceContent
+	}
+}
+
+func ClassifyDifferences(first, second string, delta Differences) Irreproducibles {
+	result := make(Irreproducibles, 0, len(delta))
+	for _, entry := range delta {
+		result = append(result, &Irreproducible{entry, classifyDifference(first, second, entry)})
+	}
+	return result
+}
+
+func buildVirtually(blueprint []byte) (root *Root, err error) {
+	defer fail.Around(&err)
+
+	tree := privateVirtual(fmt.Sprintf(" reproduce %d", os.Getpid()))
+	scorecard := common.NewScorecard()
+	scorecard.Start()
+	err = RecordEnvironment(tree, blueprint, false, scorecard)
+	fail.On(err != nil, "%v", err)
+	return tree.(*virtual).root, nil
+}
+
+// Reproduce builds same blueprint twice into virtual libraries, and reports
+// what differences there are between those two builds. Builds use private
+// stage of this process, so renaming and removing them needs no stage lock.
+func Reproduce(condafile string) (report *Reproduction, err error) {
+	defer fail.Around(&err)
+
+	_, blueprint, err := ComposeFinalBlueprint([]string{condafile}, "")
+	fail.On(err != nil, "%v", err)
+	key := BlueprintHash(blueprint)
+
+	completed := pathlib.LockWaitMessage("Serialized environment creation [holotree lock]")
+	locker, err := pathlib.SharedLocker(common.HolotreeLock(), 30000)
+	completed()
+	fail.On(err != nil, "Could not get lock for holotree. Quiting.")
+	defer locker.Release()
+
+	common.Log("Reproduce: first build of blueprint %q.", key)
+	before, err := buildVirtually(blueprint)
+	fail.On(err != nil, "First build failed, reason: %v", err)
+	stage := before.Path
+	first := stage + firstBuildSuffix
+	TryRemoveAll("first build", first)
+	err = TryRename("first build", stage, first)
+	fail.On(err != nil, "%v", err)
+	defer TryRemoveAll("first build", first)
+
+	common.Log("Reproduce: second build of blueprint %q.", key)
+	after, err := buildVirtually(blueprint)
+	fail.On(err != nil, "Second build failed, reason: %v", err)
+	second := after.Path
+	defer TryRemoveAll("stage", second)
+
+	common.TimelineBegin("holotree reproduce compare start")
+	defer common.TimelineEnd()
+	left := conda.LoadWantedDependencies(conda.GoldenMasterFilename(first))
+	right := conda.LoadWantedDependencies(conda.GoldenMasterFilename(second))
+	return &Reproduction{
+		Blueprint: key,
+		Files:     ClassifyDifferences(first, second, DiffTrees(before.Tree, after.Tree)),
+		Packages:  conda.DependencyChanges(left, right),
+	}, nil
+}
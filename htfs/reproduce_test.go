@@ -0,0 +1,73 @@
+package htfs_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/robocorp/rcc/hamlet"
+	"github.com/robocorp/rcc/htfs"
+)
+
+func buildFixture(t *testing.T, root string, files map[string]string) *htfs.Root {
+	for name, content := range files {
+		fullpath := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(fullpath), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullpath, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs, err := htfs.NewRoot(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.Bytecode = "unchecked-hash"
+	if err := fs.Lift(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.AllFiles(htfs.Locator(root)); err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestReproduceClassifiesDifferences(t *testing.T) {
+	must, _ := hamlet.Specifications(t)
+
+	first := filepath.Join(t.TempDir(), "first")
+	second := filepath.Join(t.TempDir(), "second")
+	before := buildFixture(t, first, map[string]string{
+		"same.txt":                           "same",
+		"lib/__pycache__/mod.pyc":            "bytecode 1",
+		"lib/pkg-1.0.dist-info/RECORD":       "pkg/mod.py,sha256=aaa,10",
+		"lib/pkg/_version.py":                "built = '2026-10-16T12:00:01Z'",
+		"lib/pkg/data.txt":                   "one",
+		"lib/pkg/build.txt":                  "epoch 1791000000",
+		"lib/removed-1.0.dist-info/METADATA": "removed",
+	})
+	after := buildFixture(t, second, map[string]string{
+		"same.txt":                     "same",
+		"lib/__pycache__/mod.pyc":      "bytecode 2",
+		"lib/pkg-1.0.dist-info/RECORD": "pkg/mod.py,sha256=bbb,10",
+		"lib/pkg/_version.py":          "built = '2026-10-16T12:03:44Z'",
+		"lib/pkg/data.txt":             "two",
+		"lib/pkg/build.txt":            "epoch 1791000042",
+	})
+
+	result := htfs.ClassifyDifferences(first, second, htfs.DiffTrees(before.Tree, after.Tree))
+	must.Equal(6, len(result))
+	must.Equal(1, result.Count(htfs.ReproducePyc))
+	must.Equal(1, result.Count(htfs.ReproduceRecord))
+	must.Equal(2, result.Count(htfs.ReproduceTimestamp))
+	must.Equal(2, result.Count(htfs.ReproduceContent))
+
+	classes := make(map[string]string)
+	for _, entry := range result {
+		classes[entry.Path] = entry.Class
+	}
+	must.Equal(htfs.ReproduceTimestamp, classes[filepath.Join("lib", "pkg", "_version.py")])
+	must.Equal(htfs.ReproduceContent, classes[filepath.Join("lib", "pkg", "data.txt")])
+	must.Equal(htfs.ReproduceContent, classes[filepath.Join("lib", "removed-1.0.dist-info", "METADATA")])
+}
@@ -0,0 +1,258 @@
+package htfs
+
+import (
+	"archive/zip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/fail"
+	"github.com/robocorp/rcc/pathlib"
+	"github.com/robocorp/rcc/pretty"
+	"github.com/robocorp/rcc/settings"
+)
+
+const (
+	SignatureOff     = "off"
+	SignatureWarn    = "warn"
+	SignatureEnforce = "enforce"
+
+	signatureKind = "ed25519"
+)
+
+type signature struct {
+	key  ed25519.PublicKey
+	body []byte
+}
+
+func SignaturePolicy() string {
+	policy := strings.ToLower(strings.TrimSpace(settings.Global.HolotreeSignaturePolicy()))
+	switch policy {
+	case SignatureWarn, SignatureEnforce:
+		return policy
+	default:
+		return SignatureOff
+	}
+}
+
+func SigningKeyLocation() string {
+	return filepath.Join(common.RobocorpHome(), "keys", "holotree.ed25519")
+}
+
+func SignatureLocation(catalog string) string {
+	return filepath.Join(common.HololibSignatureLocation(), fmt.Sprintf("%s.sig", filepath.Base(catalog)))
+}
+
+func signatureEntry(catalog string) string {
+	return filepath.Join("signatures", fmt.Sprintf("%s.sig", filepath.Base(catalog)))
+}
+
+func encoded(content []byte) string {
+	return base64.StdEncoding.EncodeToString(content)
+}
+
+func GenerateSigningKey() (public string, err error) {
+	defer fail.Around(&err)
+
+	location := SigningKeyLocation()
+	fail.On(pathlib.Exists(location), "Signing key %q already exists, refusing to overwrite it.", location)
+	err = os.MkdirAll(filepath.Dir(location), 0o700)
+	fail.On(err != nil, "Could not create directory for %q, reason: %v", location, err)
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	fail.On(err != nil, "Could not generate signing key, reason: %v", err)
+	err = os.WriteFile(location, []byte(encoded(privateKey.Seed())+"\n"), 0o600)
+	fail.On(err != nil, "Could not save signing key %q, reason: %v", location, err)
+	return encoded(publicKey), nil
+}
+
+func LoadSigningKey() (key ed25519.PrivateKey, err error) {
+	defer fail.Around(&err)
+
+	location := SigningKeyLocation()
+	content, err := os.ReadFile(location)
+	fail.On(err != nil, "Could not read signing key %q, reason: %v", location, err)
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+	fail.On(err != nil || len(seed) != ed25519.SeedSize, "Signing key %q is not valid ed25519 seed.", location)
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+func SigningPublicKey() (string, error) {
+	key, err := LoadSigningKey()
+	if err != nil {
+		return "", err
+	}
+	return encoded(key.Public().(ed25519.PublicKey)), nil
+}
+
+func parsePublicKey(text string) (ed25519.PublicKey, bool) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, false
+	}
+	return ed25519.PublicKey(key), true
+}
+
+func parseSignatures(content []byte) []*signature {
+	result := make([]*signature, 0, 2)
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != signatureKind {
+			continue
+		}
+		key, ok := parsePublicKey(fields[1])
+		if !ok {
+			continue
+		}
+		body, err := base64.StdEncoding.DecodeString(fields[2])
+		if err != nil || len(body) != ed25519.SignatureSize {
+			continue
+		}
+		result = append(result, &signature{key, body})
+	}
+	return result
+}
+
+func SignCatalog(catalog string) (err error) {
+	defer fail.Around(&err)
+
+	key, err := LoadSigningKey()
+	fail.On(err != nil, "%v", err)
+	content, err := os.ReadFile(catalog)
+	fail.On(err != nil, "Could not read catalog %q, reason: %v", catalog, err)
+	public := key.Public().(ed25519.PublicKey)
+	location := SignatureLocation(catalog)
+	previous, _ := os.ReadFile(location)
+	lines := make([]string, 0, 3)
+	for _, existing := range parseSignatures(previous) {
+		if !existing.key.Equal(public) {
+			lines = append(lines, fmt.Sprintf("%s %s %s", signatureKind, encoded(existing.key), encoded(existing.body)))
+		}
+	}
+	lines = append(lines, fmt.Sprintf("%s %s %s", signatureKind, encoded(public), encoded(ed25519.Sign(key, content))))
+	_, err = pathlib.MakeSharedDir(filepath.Dir(location))
+	fail.On(err != nil, "Could not create signature directory, reason: %v", err)
+	err = os.WriteFile(location, []byte(strings.Join(lines, "\n")+"\n"), 0o644)
+	fail.On(err != nil, "Could not write signature %q, reason: %v", location, err)
+	pathlib.MakeSharedFile(location)
+	return nil
+}
+
+func trustedKeys() []ed25519.PublicKey {
+	result := make([]ed25519.PublicKey, 0, 5)
+	for _, text := range settings.Global.HolotreeTrustedKeys() {
+		key, ok := parsePublicKey(text)
+		if !ok {
+			common.Debug("Ignoring invalid trusted key %q in settings.", text)
+			continue
+		}
+		result = append(result, key)
+	}
+	return result
+}
+
+func VerifySignature(content, signatures []byte, trusted []ed25519.PublicKey) error {
+	found := parseSignatures(signatures)
+	if len(found) == 0 {
+		return fmt.Errorf("no signatures")
+	}
+	for _, candidate := range found {
+		for _, key := range trusted {
+			if candidate.key.Equal(key) && ed25519.Verify(key, content, candidate.body) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("no valid signature from trusted keys")
+}
+
+func applySignaturePolicy(name string, content, signatures []byte) error {
+	policy := SignaturePolicy()
+	if policy == SignatureOff {
+		return nil
+	}
+	err := VerifySignature(content, signatures, trustedKeys())
+	if err == nil {
+		common.Debug("Catalog %q has valid signature.", name)
+		return nil
+	}
+	if policy == SignatureWarn {
+		pretty.Warning("Catalog %q signature verification failed, reason: %v", name, err)
+		return nil
+	}
+	return fmt.Errorf("Catalog %q signature verification failed, reason: %v", name, err)
+}
+
+func VerifyCatalog(catalog string) error {
+	if SignaturePolicy() == SignatureOff {
+		return nil
+	}
+	content, err := os.ReadFile(catalog)
+	if err != nil {
+		return err
+	}
+	signatures, _ := os.ReadFile(SignatureLocation(catalog))
+	return applySignaturePolicy(filepath.Base(catalog), content, signatures)
+}
+
+func readZipEntry(entry *zip.File) ([]byte, error) {
+	source, err := entry.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+	return io.ReadAll(source)
+}
+
+func (it *ziplibrary) verifyCatalog(catalog string) (err error) {
+	defer fail.Around(&err)
+
+	if SignaturePolicy() == SignatureOff {
+		return nil
+	}
+	entry, ok := it.lookup[catalog]
+	fail.On(!ok, "Missing file: %q", catalog)
+	content, err := readZipEntry(entry)
+	fail.On(err != nil, "Could not read %q, reason: %v", catalog, err)
+	var signatures []byte
+	if found, ok := it.lookup[signatureEntry(catalog)]; ok {
+		signatures, err = readZipEntry(found)
+		fail.On(err != nil, "Could not read signature of %q, reason: %v", catalog, err)
+	}
+	return applySignaturePolicy(filepath.Base(catalog), content, signatures)
+}
+
+func VerifyZipCatalogs(zipfile string) (err error) {
+	defer fail.Around(&err)
+
+	if SignaturePolicy() == SignatureOff {
+		return nil
+	}
+	archive, err := zip.OpenReader(zipfile)
+	fail.On(err != nil, "Could not open %q, reason: %v", zipfile, err)
+	defer archive.Close()
+	entries := make(map[string]*zip.File)
+	for _, entry := range archive.File {
+		entries[entry.Name] = entry
+	}
+	for name, entry := range entries {
+		if filepath.Dir(name) != "catalog" {
+			continue
+		}
+		content, err := readZipEntry(entry)
+		fail.On(err != nil, "Could not read %q from %q, reason: %v", name, zipfile, err)
+		var signatures []byte
+		if found, ok := entries[signatureEntry(name)]; ok {
+			signatures, err = readZipEntry(found)
+			fail.On(err != nil, "Could not read signature of %q from %q, reason: %v", name, zipfile, err)
+		}
+		err = applySignaturePolicy(filepath.Base(name), content, signatures)
+		fail.On(err != nil, "%v", err)
+	}
+	return nil
+}
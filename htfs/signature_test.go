@@ -0,0 +1,30 @@
+package htfs_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/robocorp/rcc/hamlet"
+	"github.com/robocorp/rcc/htfs"
+)
+
+func TestSignaturesAreVerifiedAgainstTrustedKeys(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	must.Nil(err)
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	must.Nil(err)
+
+	content := []byte("catalog content")
+	encode := base64.StdEncoding.EncodeToString
+	signatures := []byte(fmt.Sprintf("ed25519 %s %s\n", encode(public), encode(ed25519.Sign(private, content))))
+
+	must.Nil(htfs.VerifySignature(content, signatures, []ed25519.PublicKey{other, public}))
+	wont.Nil(htfs.VerifySignature(content, signatures, []ed25519.PublicKey{other}))
+	wont.Nil(htfs.VerifySignature([]byte("tampered content"), signatures, []ed25519.PublicKey{public}))
+	wont.Nil(htfs.VerifySignature(content, nil, []ed25519.PublicKey{public}))
+}
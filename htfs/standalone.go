@@ -0,0 +1,480 @@
+package htfs
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/conda"
+	"github.com/robocorp/rcc/fail"
+	"github.com/robocorp/rcc/pathlib"
+)
+
+const (
+	StandaloneManifestName = "rcc_unpack.json"
+	standaloneUnpacker     = "rcc_unpack.py"
+	standaloneUnpackScript = `#!/usr/bin/env python3
+"""Relocates standalone environment exported by rcc to its current location.
+
+Files listed in rcc_unpack.json have old environment prefix at recorded
+offsets, and those are rewritten to point to directory of this script. Text
+files get full replacement, and in binary files prefix is replaced inside its
+null terminated string, padded with nulls (so new prefix cannot be longer).
+"""
+
+import json
+import os
+import stat
+import sys
+
+MANIFEST = "rcc_unpack.json"
+
+
+def variants(prefix):
+    return [prefix, prefix.replace("\\", "/"), prefix.replace("\\", "\\\\")]
+
+
+def pairing(old, new):
+    result, seen = [], set()
+    for source, target in zip(variants(old), variants(new)):
+        if source not in seen:
+            seen.add(source)
+            result.append((source.encode("utf-8"), target.encode("utf-8")))
+    return result
+
+
+def relocate(content, offsets, identity, pairs, binary):
+    result = bytearray()
+    cursor = 0
+    for offset in sorted(offsets):
+        end = offset + len(identity)
+        if offset < cursor:
+            continue
+        for source, target in pairs:
+            start = end - len(source)
+            if start >= cursor and content[start:end] == source:
+                break
+        else:
+            continue
+        result += content[cursor:start]
+        if binary:
+            stop = content.find(b"\0", end)
+            if stop < 0:
+                stop = len(content)
+            segment = content[start:stop]
+            for source, target in pairs:
+                segment = segment.replace(source, target)
+            result += segment + b"\0" * (stop - start - len(segment))
+            cursor = stop
+        else:
+            result += target
+            cursor = end
+    result += content[cursor:]
+    return bytes(result)
+
+
+def locate(content, identity, pairs):
+    result = set()
+    for _, target in pairs:
+        at = content.find(target)
+        while at >= 0:
+            result.add(at + len(target) - len(identity))
+            at = content.find(target, at + len(target))
+    return sorted(result)
+
+
+def rewrite(fullpath, content):
+    mode = os.stat(fullpath).st_mode
+    os.chmod(fullpath, mode | stat.S_IWUSR)
+    with open(fullpath, "wb") as sink:
+        sink.write(content)
+    os.chmod(fullpath, stat.S_IMODE(mode))
+
+
+def main():
+    here = os.path.dirname(os.path.abspath(__file__))
+    manifestfile = os.path.join(here, MANIFEST)
+    with open(manifestfile, encoding="utf-8") as source:
+        manifest = json.load(source)
+    old = manifest["prefix"]
+    if old == here:
+        print("Environment is already relocated to %s." % here)
+        return 0
+    binaries = [entry["path"] for entry in manifest["files"] if entry["binary"]]
+    if binaries and len(here) > len(old):
+        print("Cannot relocate %d binary files from %s to longer path %s. Try shorter target path." % (len(binaries), old, here), file=sys.stderr)
+        return 1
+    pairs = pairing(old, here)
+    identity = manifest["identity"].encode("utf-8")
+    target = os.path.basename(here).encode("utf-8")
+    for entry in manifest["files"]:
+        fullpath = os.path.join(here, *entry["path"].split("/"))
+        with open(fullpath, "rb") as source:
+            content = source.read()
+        content = relocate(content, entry["rewrite"], identity, pairs, entry["binary"])
+        rewrite(fullpath, content)
+        entry["rewrite"] = locate(content, target, pairs)
+    manifest["prefix"] = here
+    manifest["identity"] = os.path.basename(here)
+    with open(manifestfile, "w", encoding="utf-8") as sink:
+        json.dump(manifest, sink, indent=2)
+    print("Relocated %d files from %s to %s." % (len(manifest["files"]), old, here))
+    return 0
+
+
+if __name__ == "__main__":
+    sys.exit(main())
+`
+)
+
+type StandaloneFile struct {
+	Path    string  `json:"path"`
+	Binary  bool    `json:"binary"`
+	Rewrite []int64 `json:"rewrite"`
+}
+
+type StandaloneManifest struct {
+	RccVersion string            `json:"rcc"`
+	Platform   string            `json:"platform"`
+	Blueprint  string            `json:"blueprint"`
+	Prefix     string            `json:"prefix"`
+	Identity   string            `json:"identity"`
+	Files      []*StandaloneFile `json:"files"`
+}
+
+type StandaloneExport struct {
+	Archive   string `json:"archive"`
+	Space     string `json:"space"`
+	Path      string `json:"path"`
+	Blueprint string `json:"blueprint"`
+	Entries   uint64 `json:"entries"`
+	Relocated uint64 `json:"relocated"`
+	Size      uint64 `json:"size"`
+}
+
+type standalone struct {
+	*tar.Writer
+	root     *Root
+	reserved map[string]bool
+	identity []byte
+	stamp    time.Time
+	manifest *StandaloneManifest
+	report   *StandaloneExport
+}
+
+// standaloneOffsets trusts recorded offsets when content still has identity
+// in all of them, otherwise (for example in targeted spaces) it searches.
+func standaloneOffsets(content, identity []byte, recorded []int64) []int64 {
+	valid := len(recorded) > 0
+	for _, offset := range recorded {
+		end := offset + int64(len(identity))
+		if offset < 0 || end > int64(len(content)) || !bytes.Equal(content[offset:end], identity) {
+			valid = false
+			break
+		}
+	}
+	if valid {
+		return recorded
+	}
+	result := make([]int64, 0, len(recorded))
+	cursor := 0
+	for {
+		found := bytes.Index(content[cursor:], identity)
+		if found < 0 {
+			return result
+		}
+		result = append(result, int64(cursor+found))
+		cursor += found + len(identity)
+	}
+}
+
+// standaloneSymlink makes absolute links inside environment relative, so
+// that they survive unpacking to another location.
+func standaloneSymlink(prefix, linkpath, target string) string {
+	if !filepath.IsAbs(target) {
+		return target
+	}
+	relative, err := filepath.Rel(prefix, target)
+	if err != nil || strings.HasPrefix(relative, "..") {
+		return target
+	}
+	result, err := filepath.Rel(filepath.Dir(linkpath), filepath.Join(prefix, relative))
+	if err != nil {
+		return target
+	}
+	return filepath.ToSlash(result)
+}
+
+func standaloneEnvironment(prefix string) []string {
+	activation := make([]string, 0, 20)
+	for _, entry := range conda.LoadActivationEnvironment(prefix) {
+		if !strings.HasPrefix(strings.ToUpper(entry), "PATH=") {
+			activation = append(activation, entry)
+		}
+	}
+	sort.Strings(activation)
+	result := []string{
+		"CONDA_DEFAULT_ENV=rcc",
+		"CONDA_PREFIX=" + prefix,
+		"CONDA_PROMPT_MODIFIER=(rcc) ",
+		"CONDA_SHLVL=1",
+		"PYTHONHOME=",
+		"PYTHONNOUSERSITE=1",
+	}
+	return append(result, activation...)
+}
+
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+func standaloneScripts(prefix string) map[string]string {
+	environment := standaloneEnvironment(prefix)
+	paths := conda.CondaPaths(prefix)
+	if conda.IsWindows() {
+		activate := []string{"@echo off"}
+		for _, entry := range environment {
+			activate = append(activate, fmt.Sprintf("set \"%s\"", entry))
+		}
+		activate = append(activate, fmt.Sprintf("set \"PATH=%s;%%PATH%%\"", strings.Join(paths, ";")))
+		return map[string]string{
+			"activate.cmd":   strings.Join(activate, "\r\n") + "\r\n",
+			"rcc_unpack.cmd": "@echo off\r\n\"%~dp0python.exe\" \"%~dp0" + standaloneUnpacker + "\" %*\r\n",
+		}
+	}
+	activate := []string{"# Source this file to activate standalone environment exported by rcc."}
+	for _, entry := range environment {
+		name, value, _ := strings.Cut(entry, "=")
+		if len(value) == 0 {
+			activate = append(activate, fmt.Sprintf("unset %s", name))
+		} else {
+			activate = append(activate, fmt.Sprintf("export %s=%s", name, shellQuote(value)))
+		}
+	}
+	activate = append(activate, fmt.Sprintf("export PATH=%s:\"$PATH\"", shellQuote(strings.Join(paths, ":"))))
+	unpack := []string{
+		"#!/bin/sh",
+		"here=\"$(cd \"$(dirname \"$0\")\" && pwd)\"",
+		"python=\"$here/bin/python3\"",
+		"if [ ! -x \"$python\" ]; then",
+		"  python=python3",
+		"fi",
+		"exec \"$python\" \"$here/" + standaloneUnpacker + "\" \"$@\"",
+	}
+	return map[string]string{
+		"activate.sh":   strings.Join(activate, "\n") + "\n",
+		"rcc_unpack.sh": strings.Join(unpack, "\n") + "\n",
+	}
+}
+
+func (it *standalone) header(name string, kind byte, mode os.FileMode, size int64) *tar.Header {
+	it.report.Entries += 1
+	return &tar.Header{
+		Typeflag: kind,
+		Name:     name,
+		Mode:     int64(mode.Perm()),
+		Size:     size,
+		ModTime:  it.stamp,
+	}
+}
+
+func (it *standalone) content(name string, mode os.FileMode, content []byte, recorded []int64) error {
+	err := it.WriteHeader(it.header(name, tar.TypeReg, mode, int64(len(content))))
+	if err != nil {
+		return err
+	}
+	_, err = it.Write(content)
+	if err != nil {
+		return err
+	}
+	offsets := standaloneOffsets(content, it.identity, recorded)
+	if len(offsets) > 0 {
+		it.report.Relocated += 1
+		it.manifest.Files = append(it.manifest.Files, &StandaloneFile{
+			Path:    name,
+			Binary:  bytes.IndexByte(content, 0) >= 0,
+			Rewrite: offsets,
+		})
+	}
+	return nil
+}
+
+func (it *standalone) file(fullpath, name string, details *File) error {
+	if details.IsSymlink() {
+		target := standaloneSymlink(it.root.Path, fullpath, details.Symlink)
+		header := it.header(name, tar.TypeSymlink, 0o777, 0)
+		header.Linkname = target
+		return it.WriteHeader(header)
+	}
+	if len(details.Rewrite) > 0 {
+		content, err := os.ReadFile(fullpath)
+		if err != nil {
+			return err
+		}
+		return it.content(name, details.Mode, content, details.Rewrite)
+	}
+	source, err := os.Open(fullpath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+	err = it.WriteHeader(it.header(name, tar.TypeReg, details.Mode, info.Size()))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(it, source)
+	return err
+}
+
+func (it *standalone) directory(fullpath, name string, dir *Dir) error {
+	if dir.IsSymlink() {
+		header := it.header(name, tar.TypeSymlink, 0o777, 0)
+		header.Linkname = standaloneSymlink(it.root.Path, fullpath, dir.Symlink)
+		return it.WriteHeader(header)
+	}
+	if len(name) > 0 {
+		err := it.WriteHeader(it.header(name+"/", tar.TypeDir, dir.Mode, 0))
+		if err != nil {
+			return err
+		}
+	}
+	files := make([]string, 0, len(dir.Files))
+	for key := range dir.Files {
+		files = append(files, key)
+	}
+	sort.Strings(files)
+	for _, key := range files {
+		if len(name) == 0 && it.reserved[key] {
+			continue
+		}
+		err := it.file(filepath.Join(fullpath, key), path.Join(name, key), dir.Files[key])
+		if err != nil {
+			return err
+		}
+	}
+	dirs := make([]string, 0, len(dir.Dirs))
+	for key, subdir := range dir.Dirs {
+		if !subdir.Shadow {
+			dirs = append(dirs, key)
+		}
+	}
+	sort.Strings(dirs)
+	for _, key := range dirs {
+		err := it.directory(filepath.Join(fullpath, key), path.Join(name, key), dir.Dirs[key])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (it *standalone) finish(scripts map[string]string) error {
+	names := make([]string, 0, len(scripts))
+	for name := range scripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		err := it.content(name, 0o755, []byte(scripts[name]), nil)
+		if err != nil {
+			return err
+		}
+	}
+	body, err := json.MarshalIndent(it.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = it.WriteHeader(it.header(StandaloneManifestName, tar.TypeReg, 0o644, int64(len(body))))
+	if err != nil {
+		return err
+	}
+	_, err = it.Write(body)
+	return err
+}
+
+// ExportStandalone writes space as tar.gz archive, which unpacks into working
+// environment without rcc. After unpacking, rcc_unpack script rewrites
+// recorded prefix locations to new place, and activate script sets up
+// captured activation environment.
+func ExportStandalone(metafile, archive string) (report *StandaloneExport, err error) {
+	defer fail.Around(&err)
+
+	targetdir := metafile[:len(metafile)-len(filepath.Ext(metafile))]
+	common.TimelineBegin("holotree standalone export %q", targetdir)
+	defer common.TimelineEnd()
+
+	completed := pathlib.LockWaitMessage("Serialized standalone export [space lock]")
+	locker, err := pathlib.Locker(targetdir+".lck", 30000)
+	completed()
+	fail.On(err != nil, "Could not get lock for space %q. Quiting.", targetdir)
+	defer locker.Release()
+
+	fs, err := NewRoot(targetdir)
+	fail.On(err != nil, "Could not create root for %q, reason: %v", targetdir, err)
+	err = fs.LoadFrom(metafile)
+	fail.On(err != nil, "Could not load %q, reason: %v", metafile, err)
+	fail.On(!pathlib.IsDir(fs.Path), "Space directory %q does not exist.", fs.Path)
+
+	sink, err := os.Create(archive)
+	fail.On(err != nil, "Could not create %q, reason: %v", archive, err)
+	defer func() {
+		sink.Close()
+		if err != nil {
+			os.Remove(archive)
+		}
+	}()
+	scripts := standaloneScripts(fs.Path)
+	scripts[standaloneUnpacker] = standaloneUnpackScript
+	reserved := map[string]bool{StandaloneManifestName: true}
+	for name := range scripts {
+		reserved[name] = true
+	}
+	compressor := gzip.NewWriter(sink)
+	writer := &standalone{
+		Writer:   tar.NewWriter(compressor),
+		root:     fs,
+		reserved: reserved,
+		identity: []byte(filepath.Base(fs.Path)),
+		stamp:    time.Now().Truncate(time.Second),
+		manifest: &StandaloneManifest{
+			RccVersion: common.Version,
+			Platform:   fs.Platform,
+			Blueprint:  fs.Blueprint,
+			Prefix:     fs.Path,
+			Identity:   filepath.Base(fs.Path),
+			Files:      make([]*StandaloneFile, 0, 100),
+		},
+		report: &StandaloneExport{
+			Archive:   archive,
+			Space:     fs.Space,
+			Path:      fs.Path,
+			Blueprint: fs.Blueprint,
+		},
+	}
+	err = writer.directory(fs.Path, "", fs.Tree)
+	fail.On(err != nil, "Could not archive %q, reason: %v", fs.Path, err)
+	err = writer.finish(scripts)
+	fail.On(err != nil, "Could not finish %q, reason: %v", archive, err)
+	err = writer.Close()
+	fail.On(err != nil, "Could not close %q, reason: %v", archive, err)
+	err = compressor.Close()
+	fail.On(err != nil, "Could not close %q, reason: %v", archive, err)
+	info, err := sink.Stat()
+	fail.On(err != nil, "Could not stat %q, reason: %v", archive, err)
+	writer.report.Size = uint64(info.Size())
+	return writer.report, nil
+}
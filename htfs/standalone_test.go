@@ -0,0 +1,26 @@
+package htfs
+
+import (
+	"testing"
+
+	"github.com/robocorp/rcc/hamlet"
+)
+
+func TestStandaloneOffsetsTrustOnlyMatchingRecords(t *testing.T) {
+	must, _ := hamlet.Specifications(t)
+
+	content := []byte("#!/opt/holotree/h1234/bin/python\nprefix=/opt/holotree/h1234\n")
+	identity := []byte("h1234")
+	must.Equal([]int64{16, 54}, standaloneOffsets(content, identity, []int64{16, 54}))
+	must.Equal([]int64{16, 54}, standaloneOffsets(content, identity, []int64{10}))
+	must.Equal([]int64{16, 54}, standaloneOffsets(content, identity, nil))
+	must.Equal(0, len(standaloneOffsets([]byte("nothing here"), identity, nil)))
+}
+
+func TestStandaloneSymlinksInsideEnvironmentBecomeRelative(t *testing.T) {
+	must, _ := hamlet.Specifications(t)
+
+	must.Equal("python3.10", standaloneSymlink("/opt/env", "/opt/env/bin/python", "python3.10"))
+	must.Equal("../lib/libpython.so", standaloneSymlink("/opt/env", "/opt/env/bin/libpython.so", "/opt/env/lib/libpython.so"))
+	must.Equal("/usr/lib/libc.so", standaloneSymlink("/opt/env", "/opt/env/lib/libc.so", "/usr/lib/libc.so"))
+}
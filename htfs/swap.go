@@ -0,0 +1,189 @@
+package htfs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/fail"
+	"github.com/robocorp/rcc/pathlib"
+	"github.com/robocorp/rcc/settings"
+)
+
+const (
+	stagedSuffix  = ".swapnew"
+	retiredSuffix = ".swapold"
+)
+
+func SwapRestore() bool {
+	return settings.Global.SwapRestore() && !common.Liveonly
+}
+
+func UsageFile(targetdir string) string {
+	return targetdir + ".use"
+}
+
+func stateFile(generation string) string {
+	return generation + ".state"
+}
+
+// UseSpace marks space as being used, so that swap restores keep its
+// current generation around until returned releaser is released.
+func UseSpace(targetdir string) (releaser pathlib.Releaser, err error) {
+	defer fail.Around(&err)
+
+	completed := pathlib.LockWaitMessage("Serialized holotree use [holotree base lock]")
+	locker, err := pathlib.Locker(targetdir+".lck", 30000)
+	completed()
+	fail.On(err != nil, "Could not get lock for %s. Quiting.", targetdir)
+	defer locker.Release()
+	return pathlib.UsageLocker(UsageFile(targetdir))
+}
+
+func generationName(targetdir, suffix string) string {
+	return fmt.Sprintf("%s%s_%x_%d", targetdir, suffix, time.Now().UnixNano(), os.Getpid())
+}
+
+func generations(targetdir, suffix string) []string {
+	basedir := filepath.Dir(targetdir)
+	prefix := filepath.Base(targetdir) + suffix
+	result := make([]string, 0, 2)
+	entries, err := os.ReadDir(basedir)
+	if err != nil {
+		return result
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), prefix) {
+			result = append(result, filepath.Join(basedir, entry.Name()))
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func unusedGeneration(generation string) bool {
+	locker, ok := pathlib.TryLocker(UsageFile(generation))
+	if !ok {
+		common.Debug("Holotree generation %q is still in use, keeping it.", generation)
+		return false
+	}
+	defer os.Remove(UsageFile(generation))
+	defer locker.Release()
+	return true
+}
+
+func idleGenerations(targetdir string) []string {
+	result := generations(targetdir, stagedSuffix)
+	for _, generation := range generations(targetdir, retiredSuffix) {
+		if unusedGeneration(generation) {
+			result = append(result, generation)
+		}
+	}
+	return result
+}
+
+func recycleGeneration(targetdir string) string {
+	staged := generationName(targetdir, stagedSuffix)
+	recycled := false
+	for _, generation := range idleGenerations(targetdir) {
+		if recycled || !pathlib.IsFile(stateFile(generation)) {
+			common.Debug("Removing idle holotree generation %q.", generation)
+			os.Remove(stateFile(generation))
+			TryRemoveAll("generation", generation)
+			continue
+		}
+		err := os.Rename(generation, staged)
+		if err == nil {
+			err = os.Rename(stateFile(generation), stateFile(staged))
+		}
+		if err != nil {
+			common.Debug("Could not recycle holotree generation %q, reason: %v", generation, err)
+			continue
+		}
+		common.Debug("Recycling idle holotree generation %q as %q.", generation, staged)
+		recycled = true
+	}
+	return staged
+}
+
+func swapSpace(staged, targetdir string) (err error) {
+	defer fail.Around(&err)
+
+	common.TimelineBegin("holotree swap start %q", targetdir)
+	defer common.TimelineEnd()
+	if !pathlib.Exists(targetdir) {
+		return os.Rename(staged, targetdir)
+	}
+	retired := generationName(targetdir, retiredSuffix)
+	err = os.Rename(targetdir, retired)
+	fail.On(err != nil, "Could not retire previous generation of %q, reason: %v", targetdir, err)
+	err = os.Rename(staged, targetdir)
+	if err != nil {
+		os.Rename(retired, targetdir)
+		fail.On(true, "Could not swap in new generation of %q, reason: %v", targetdir, err)
+	}
+	if pathlib.Exists(UsageFile(targetdir)) {
+		os.Rename(UsageFile(targetdir), UsageFile(retired))
+	}
+	if pathlib.IsFile(targetdir + ".meta") {
+		pathlib.CopyFile(targetdir+".meta", stateFile(retired), true)
+	}
+	common.Debug("Holotree space %q swapped in, previous generation is %q.", targetdir, retired)
+	return nil
+}
+
+// generationState replaces current state with state of recycled generation,
+// since state of previous space does not describe files in staged directory.
+// Protection of recycled generation is lifted, since restore writes into it.
+func generationState(staged string, current map[string]string) {
+	for key := range current {
+		delete(current, key)
+	}
+	if !pathlib.Exists(staged) {
+		return
+	}
+	defer os.Remove(stateFile(staged))
+	shadow, err := NewRoot(staged)
+	if err == nil {
+		err = shadow.LoadFrom(stateFile(staged))
+	}
+	if err != nil {
+		common.Debug("Could not load state of recycled generation %q, reason: %v", staged, err)
+		TryRemoveAll("generation", staged)
+		return
+	}
+	shadow.Path = staged
+	unprotectSpace(shadow)
+	shadow.Treetop(DigestRecorder(current))
+}
+
+func swapping(fs *Root, targetdir string, current map[string]string) func() error {
+	if !SwapRestore() {
+		return func() error {
+			return nil
+		}
+	}
+	staged := recycleGeneration(targetdir)
+	generationState(staged, current)
+	common.Timeline("holotree swap restore into %q", staged)
+	fs.Path = staged
+	return func() error {
+		fs.Path = targetdir
+		return swapSpace(staged, targetdir)
+	}
+}
+
+func removeGenerations(targetdir string) {
+	for _, suffix := range []string{stagedSuffix, retiredSuffix} {
+		for _, generation := range generations(targetdir, suffix) {
+			os.Remove(UsageFile(generation))
+			os.Remove(stateFile(generation))
+			TryRemoveAll("generation", generation)
+		}
+	}
+	os.Remove(UsageFile(targetdir))
+}
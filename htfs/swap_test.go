@@ -0,0 +1,83 @@
+package htfs
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/robocorp/rcc/hamlet"
+	"github.com/robocorp/rcc/pathlib"
+)
+
+func TestSwapKeepsPreviousGenerationWhileInUse(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	targetdir := filepath.Join(t.TempDir(), "space")
+	must.Nil(os.MkdirAll(targetdir, 0o755))
+	must.Nil(os.WriteFile(filepath.Join(targetdir, "version.txt"), []byte("blue"), 0o644))
+	must.Nil(os.WriteFile(targetdir+".meta", []byte("blue state"), 0o644))
+	user, err := pathlib.UsageLocker(UsageFile(targetdir))
+	must.Nil(err)
+
+	staged := recycleGeneration(targetdir)
+	must.Nil(os.MkdirAll(staged, 0o755))
+	must.Nil(os.WriteFile(filepath.Join(staged, "version.txt"), []byte("green"), 0o644))
+	must.Nil(swapSpace(staged, targetdir))
+
+	content, err := os.ReadFile(filepath.Join(targetdir, "version.txt"))
+	must.Nil(err)
+	must.Equal("green", string(content))
+	wont.True(pathlib.Exists(staged))
+	wont.True(pathlib.Exists(UsageFile(targetdir)))
+
+	retired := generations(targetdir, retiredSuffix)
+	must.Equal(1, len(retired))
+	must.True(pathlib.Exists(UsageFile(retired[0])))
+	must.True(pathlib.IsFile(stateFile(retired[0])))
+	must.Equal(0, len(idleGenerations(targetdir)))
+
+	must.Nil(user.Release())
+	recycled := recycleGeneration(targetdir)
+	content, err = os.ReadFile(filepath.Join(recycled, "version.txt"))
+	must.Nil(err)
+	must.Equal("blue", string(content))
+	must.True(pathlib.IsFile(stateFile(recycled)))
+	must.Equal(0, len(generations(targetdir, retiredSuffix)))
+
+	generationState(recycled, map[string]string{"stale": "state"})
+	wont.True(pathlib.Exists(recycled))
+	wont.True(pathlib.Exists(stateFile(recycled)))
+}
+
+func TestRecycledProtectedGenerationIsWritableAgain(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("space protection is not used on windows")
+	}
+	must, _ := hamlet.Specifications(t)
+
+	targetdir := filepath.Join(t.TempDir(), "space")
+	must.Nil(os.MkdirAll(filepath.Join(targetdir, "lib"), 0o755))
+	must.Nil(os.WriteFile(filepath.Join(targetdir, "lib", "module.py"), []byte("pass"), 0o644))
+	fs, err := NewRoot(targetdir)
+	must.Nil(err)
+	must.Nil(fs.Lift())
+	fs.Protected = true
+	must.Nil(fs.AllDirs(ProtectDirectory(nil)))
+	must.Nil(fs.SaveAs(targetdir + ".meta"))
+	must.Equal(os.FileMode(0o555), modeOf(filepath.Join(targetdir, "lib")))
+
+	staged := recycleGeneration(targetdir)
+	must.Nil(os.MkdirAll(staged, 0o755))
+	must.Nil(swapSpace(staged, targetdir))
+
+	recycled := recycleGeneration(targetdir)
+	current := map[string]string{}
+	generationState(recycled, current)
+	must.True(pathlib.IsDir(recycled))
+	must.Equal(1, len(current))
+	must.Equal(os.FileMode(0o755), modeOf(recycled))
+	must.Equal(os.FileMode(0o755), modeOf(filepath.Join(recycled, "lib")))
+	must.Equal(os.FileMode(0o644), modeOf(filepath.Join(recycled, "lib", "module.py")))
+	must.Nil(os.WriteFile(filepath.Join(recycled, "lib", "other.py"), []byte("pass"), 0o644))
+}
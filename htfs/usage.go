@@ -0,0 +1,265 @@
+package htfs
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/robocorp/rcc/common"
+)
+
+var (
+	packageSuffixes = regexp.MustCompile(`(?i)(-[0-9][^/]*)?(\.dist-info|\.egg-info|\.data|\.libs|\.py|\.pth)?$`)
+)
+
+type UsageEntry struct {
+	Name  string `json:"name"`
+	Files uint64 `json:"files"`
+	Bytes uint64 `json:"bytes"`
+}
+
+type UsageEntries []*UsageEntry
+
+type CatalogUsage struct {
+	Name        string       `json:"name"`
+	Blueprint   string       `json:"blueprint"`
+	Files       uint64       `json:"files"`
+	Bytes       uint64       `json:"bytes"`
+	Unique      uint64       `json:"unique"`
+	Shared      uint64       `json:"shared"`
+	Packages    UsageEntries `json:"packages"`
+	Directories UsageEntries `json:"directories"`
+}
+
+type SpaceUsage struct {
+	Identity   string `json:"identity"`
+	Space      string `json:"space"`
+	Controller string `json:"controller"`
+	Blueprint  string `json:"blueprint"`
+	Path       string `json:"path"`
+	Files      uint64 `json:"files"`
+	Bytes      uint64 `json:"bytes"`
+	Duplicated uint64 `json:"duplicated"`
+}
+
+type DuplicateUsage struct {
+	Digest string   `json:"digest"`
+	Size   uint64   `json:"size"`
+	Copies uint64   `json:"copies"`
+	Wasted uint64   `json:"wasted"`
+	Paths  []string `json:"paths"`
+}
+
+type DiskUsage struct {
+	Referenced uint64            `json:"referenced"`
+	Stored     uint64            `json:"stored"`
+	Shared     uint64            `json:"shared"`
+	Ratio      float64           `json:"dedup-ratio"`
+	Wasted     uint64            `json:"wasted"`
+	Hardlinks  bool              `json:"hardlinks"`
+	Catalogs   []*CatalogUsage   `json:"catalogs"`
+	Spaces     []*SpaceUsage     `json:"spaces"`
+	Duplicates []*DuplicateUsage `json:"duplicates"`
+}
+
+type usageVisitor func(path string, details *File)
+
+func visitFiles(path string, it *Dir, visit usageVisitor) {
+	if it.Shadow || it.IsSymlink() {
+		return
+	}
+	for name, details := range it.Files {
+		if !details.IsSymlink() {
+			visit(filepath.Join(path, name), details)
+		}
+	}
+	for name, subdir := range it.Dirs {
+		visitFiles(filepath.Join(path, name), subdir, visit)
+	}
+}
+
+func packageName(path string) (string, bool) {
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	for at, part := range parts[:len(parts)-1] {
+		if part == "site-packages" {
+			name := packageSuffixes.ReplaceAllString(parts[at+1], "")
+			return strings.ToLower(strings.ReplaceAll(name, "-", "_")), len(name) > 0
+		}
+	}
+	return "", false
+}
+
+func addUsage(target map[string]*UsageEntry, name string, size uint64) {
+	entry, ok := target[name]
+	if !ok {
+		entry = &UsageEntry{Name: name}
+		target[name] = entry
+	}
+	entry.Files += 1
+	entry.Bytes += size
+}
+
+func largest(source map[string]*UsageEntry, top int) UsageEntries {
+	result := make(UsageEntries, 0, len(source))
+	for _, entry := range source {
+		result = append(result, entry)
+	}
+	sort.SliceStable(result, func(left, right int) bool {
+		if result[left].Bytes == result[right].Bytes {
+			return result[left].Name < result[right].Name
+		}
+		return result[left].Bytes > result[right].Bytes
+	})
+	if top > 0 && len(result) > top {
+		return result[:top]
+	}
+	return result
+}
+
+func catalogUsage(catalog *Root, top int) (*CatalogUsage, map[string]uint64) {
+	usage := &CatalogUsage{
+		Name:      filepath.Base(catalog.Source()),
+		Blueprint: catalog.Blueprint,
+	}
+	digests := make(map[string]uint64)
+	packages := make(map[string]*UsageEntry)
+	directories := make(map[string]*UsageEntry)
+	visitFiles("", catalog.Tree, func(path string, details *File) {
+		size := uint64(details.Size)
+		usage.Files += 1
+		usage.Bytes += size
+		digests[details.Digest] = size
+		addUsage(directories, filepath.Dir(path), size)
+		if name, ok := packageName(path); ok {
+			addUsage(packages, name, size)
+		}
+	})
+	usage.Packages = largest(packages, top)
+	usage.Directories = largest(directories, top)
+	return usage, digests
+}
+
+type duplicate struct {
+	size  uint64
+	paths []string
+}
+
+func spaceUsage(space *Root, hardlinks bool, copies map[string]*duplicate) *SpaceUsage {
+	usage := &SpaceUsage{
+		Identity:   space.Identity,
+		Space:      space.Space,
+		Controller: space.Controller,
+		Blueprint:  space.Blueprint,
+		Path:       space.Path,
+	}
+	visitFiles(space.Path, space.Tree, func(path string, details *File) {
+		usage.Files += 1
+		usage.Bytes += uint64(details.Size)
+		if details.Size == 0 || (hardlinks && linkable(details)) {
+			return
+		}
+		found, ok := copies[details.Digest]
+		if !ok {
+			found = &duplicate{size: uint64(details.Size)}
+			copies[details.Digest] = found
+		}
+		found.paths = append(found.paths, path)
+	})
+	return usage
+}
+
+// CalculateDiskUsage reports uncompressed sizes of catalogs and spaces, and
+// how much content is shared between catalogs or duplicated between spaces.
+func CalculateDiskUsage(top int) *DiskUsage {
+	common.TimelineBegin("holotree disk usage start")
+	defer common.TimelineEnd()
+
+	hardlinks := RestoreMode() == RestoreHardlink
+	result := &DiskUsage{
+		Hardlinks:  hardlinks,
+		Catalogs:   make([]*CatalogUsage, 0, 20),
+		Spaces:     make([]*SpaceUsage, 0, 20),
+		Duplicates: make([]*DuplicateUsage, 0, top),
+	}
+
+	_, roots := LoadCatalogs()
+	sizes := make(map[string]uint64)
+	users := make(map[string]int)
+	perCatalog := make([]map[string]uint64, 0, len(roots))
+	for _, catalog := range roots {
+		if catalog == nil {
+			continue
+		}
+		usage, digests := catalogUsage(catalog, top)
+		result.Catalogs = append(result.Catalogs, usage)
+		perCatalog = append(perCatalog, digests)
+		for digest, size := range digests {
+			sizes[digest] = size
+			users[digest] += 1
+			result.Referenced += size
+		}
+	}
+	for digest, size := range sizes {
+		result.Stored += size
+		if users[digest] > 1 {
+			result.Shared += size
+		}
+	}
+	for at, digests := range perCatalog {
+		for digest, size := range digests {
+			if users[digest] > 1 {
+				result.Catalogs[at].Shared += size
+			} else {
+				result.Catalogs[at].Unique += size
+			}
+		}
+	}
+	if result.Stored > 0 {
+		result.Ratio = float64(result.Referenced) / float64(result.Stored)
+	}
+	sort.SliceStable(result.Catalogs, func(left, right int) bool {
+		return result.Catalogs[left].Bytes > result.Catalogs[right].Bytes
+	})
+
+	copies := make(map[string]*duplicate)
+	for _, space := range Spaces() {
+		result.Spaces = append(result.Spaces, spaceUsage(space, hardlinks, copies))
+	}
+	for digest, found := range copies {
+		count := uint64(len(found.paths))
+		if count < 2 {
+			continue
+		}
+		sort.Strings(found.paths)
+		wasted := (count - 1) * found.size
+		result.Wasted += wasted
+		for _, space := range result.Spaces {
+			for _, path := range found.paths[1:] {
+				if strings.HasPrefix(path, space.Path+string(filepath.Separator)) {
+					space.Duplicated += found.size
+				}
+			}
+		}
+		result.Duplicates = append(result.Duplicates, &DuplicateUsage{
+			Digest: digest,
+			Size:   found.size,
+			Copies: count,
+			Wasted: wasted,
+			Paths:  found.paths,
+		})
+	}
+	sort.SliceStable(result.Spaces, func(left, right int) bool {
+		return result.Spaces[left].Bytes > result.Spaces[right].Bytes
+	})
+	sort.SliceStable(result.Duplicates, func(left, right int) bool {
+		if result.Duplicates[left].Wasted == result.Duplicates[right].Wasted {
+			return result.Duplicates[left].Digest < result.Duplicates[right].Digest
+		}
+		return result.Duplicates[left].Wasted > result.Duplicates[right].Wasted
+	})
+	if top > 0 && len(result.Duplicates) > top {
+		result.Duplicates = result.Duplicates[:top]
+	}
+	return result
+}
@@ -0,0 +1,102 @@
+package htfs
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/robocorp/rcc/hamlet"
+)
+
+func usageTree(files map[string]int64, dirs map[string]*Dir) *Dir {
+	result := newDir("", "", false)
+	for name, size := range files {
+		result.Files[name] = &File{Name: name, Size: size, Digest: name}
+	}
+	for name, dir := range dirs {
+		result.Dirs[name] = dir
+	}
+	return result
+}
+
+func TestPackageNamesAreNormalized(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	name, ok := packageName("lib/python3.10/site-packages/numpy/core/multiarray.so")
+	must.True(ok)
+	must.Equal("numpy", name)
+
+	name, ok = packageName("lib/python3.10/site-packages/Robot-Framework-6.1.1.dist-info/RECORD")
+	must.True(ok)
+	must.Equal("robot_framework", name)
+
+	name, ok = packageName("lib/python3.10/site-packages/numpy.libs/libopenblas.so")
+	must.True(ok)
+	must.Equal("numpy", name)
+
+	name, ok = packageName("lib/python3.10/site-packages/six.py")
+	must.True(ok)
+	must.Equal("six", name)
+
+	_, ok = packageName("bin/python3")
+	wont.True(ok)
+}
+
+func TestCatalogUsageFindsLargestPackagesAndDirectories(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	site := usageTree(nil, map[string]*Dir{
+		"numpy":                usageTree(map[string]int64{"core.so": 700, "init.py": 10}, nil),
+		"numpy-1.26.dist-info": usageTree(map[string]int64{"RECORD": 20}, nil),
+		"six-1.16.dist-info":   usageTree(map[string]int64{"METADATA": 5}, nil),
+	})
+	shadow := usageTree(map[string]int64{"hidden": 9999}, nil)
+	shadow.Shadow = true
+	root := &Root{
+		Blueprint: "cafe",
+		Tree: usageTree(map[string]int64{"python3": 300}, map[string]*Dir{
+			"site-packages": site,
+			"shadow":        shadow,
+		}),
+	}
+
+	usage, digests := catalogUsage(root, 2)
+	wont.Nil(usage)
+	must.Equal("cafe", usage.Blueprint)
+	must.Equal(uint64(5), usage.Files)
+	must.Equal(uint64(1035), usage.Bytes)
+	must.Equal(5, len(digests))
+
+	must.Equal(2, len(usage.Packages))
+	must.Equal("numpy", usage.Packages[0].Name)
+	must.Equal(uint64(730), usage.Packages[0].Bytes)
+	must.Equal(uint64(3), usage.Packages[0].Files)
+	must.Equal("six", usage.Packages[1].Name)
+
+	must.Equal(2, len(usage.Directories))
+	must.Equal(filepath.Join("site-packages", "numpy"), usage.Directories[0].Name)
+	must.Equal(".", usage.Directories[1].Name)
+}
+
+func TestSpaceUsageCollectsDuplicatedContent(t *testing.T) {
+	must, _ := hamlet.Specifications(t)
+
+	copies := make(map[string]*duplicate)
+	first := &Root{
+		Path: filepath.Join("spaces", "first"),
+		Tree: usageTree(map[string]int64{"big": 100, "empty": 0}, nil),
+	}
+	second := &Root{
+		Path: filepath.Join("spaces", "second"),
+		Tree: usageTree(map[string]int64{"big": 100, "small": 1}, nil),
+	}
+
+	usage := spaceUsage(first, false, copies)
+	must.Equal(uint64(2), usage.Files)
+	must.Equal(uint64(100), usage.Bytes)
+	usage = spaceUsage(second, false, copies)
+	must.Equal(uint64(101), usage.Bytes)
+
+	must.Equal(2, len(copies))
+	must.Equal(2, len(copies["big"].paths))
+	must.Equal(1, len(copies["small"].paths))
+}
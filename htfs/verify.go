@@ -0,0 +1,323 @@
+package htfs
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/robocorp/rcc/anywork"
+	"github.com/robocorp/rcc/common"
+	"github.com/robocorp/rcc/fail"
+	"github.com/robocorp/rcc/pathlib"
+)
+
+const (
+	DriftModified = "modified"
+	DriftAdded    = "added"
+	DriftMissing  = "missing"
+)
+
+type Drift struct {
+	Path     string `json:"path"`
+	Status   string `json:"status"`
+	Reason   string `json:"reason"`
+	fullpath string
+	file     *File
+	dir      *Dir
+}
+
+type Drifts []*Drift
+
+func (it Drifts) Count(status string) int {
+	total := 0
+	for _, entry := range it {
+		if entry.Status == status {
+			total += 1
+		}
+	}
+	return total
+}
+
+type SpaceDrift struct {
+	sync.Mutex `json:"-"`
+	Identity   string `json:"identity"`
+	Space      string `json:"space"`
+	Path       string `json:"path"`
+	Blueprint  string `json:"blueprint"`
+	Checked    uint64 `json:"checked"`
+	Drifts     Drifts `json:"drifts"`
+	Healed     bool   `json:"healed"`
+	root       *Root
+}
+
+func (it *SpaceDrift) checked() {
+	it.Lock()
+	defer it.Unlock()
+	it.Checked += 1
+}
+
+func (it *SpaceDrift) drift(status, fullpath, reason string, file *File, dir *Dir) {
+	it.Lock()
+	defer it.Unlock()
+	relative, err := filepath.Rel(it.root.Path, fullpath)
+	if err != nil {
+		relative = fullpath
+	}
+	it.Drifts = append(it.Drifts, &Drift{relative, status, reason, fullpath, file, dir})
+}
+
+func FindSpaces(name string) []string {
+	spaces := make([]string, 0, 2)
+	for directory, metafile := range Spacemap() {
+		if filepath.Base(directory) == name {
+			spaces = append(spaces, metafile)
+			continue
+		}
+		shadow, err := NewRoot(directory)
+		if err != nil {
+			continue
+		}
+		if shadow.LoadHeaderFrom(metafile) == nil && shadow.Space == name {
+			spaces = append(spaces, metafile)
+		}
+	}
+	sort.Strings(spaces)
+	return spaces
+}
+
+func fileDigest(filename string) (string, error) {
+	source, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer source.Close()
+	digester := sha256.New()
+	_, err = io.Copy(digester, source)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%02x", digester.Sum(nil)), nil
+}
+
+func expectedDigest(library Library, fs *Root, details *File) (string, error) {
+	reader, closer, err := library.Open(details.Digest)
+	if err != nil {
+		return "", err
+	}
+	defer closer()
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	if fs.relocation != nil {
+		content, _, _ = fs.relocation.Relocate(content)
+	} else {
+		rewrite := fs.Rewrite()
+		for _, position := range details.Rewrite {
+			if position >= 0 && int(position)+len(rewrite) <= len(content) {
+				copy(content[position:], rewrite)
+			}
+		}
+	}
+	return fmt.Sprintf("%02x", sha256.Sum256(content)), nil
+}
+
+func verifyDrift(library Library, fs *Root, report *SpaceDrift, fullpath string, details *File) anywork.Work {
+	return func() {
+		actual, err := fileDigest(fullpath)
+		if err != nil {
+			report.drift(DriftModified, fullpath, fmt.Sprintf("unreadable: %v", err), details, nil)
+			return
+		}
+		expected := details.Digest
+		if len(details.Rewrite) > 0 {
+			expected, err = expectedDigest(library, fs, details)
+			if err != nil {
+				common.Debug("Could not verify %q against library, reason: %v", fullpath, err)
+				return
+			}
+		}
+		if actual != expected {
+			report.drift(DriftModified, fullpath, "content", details, nil)
+		}
+	}
+}
+
+func expectedMode(fs *Root, details *File, mode os.FileMode) bool {
+	if mode == details.Mode {
+		return true
+	}
+	return fs.Protected && mode == details.Mode&^writeBits
+}
+
+func VerifyDirectory(library Library, fs *Root, report *SpaceDrift) Dirtask {
+	return func(path string, it *Dir) anywork.Work {
+		return func() {
+			if it.Shadow || it.IsSymlink() {
+				return
+			}
+			entries, err := os.ReadDir(path)
+			if err != nil {
+				if os.IsNotExist(err) {
+					return
+				}
+				anywork.OnErrPanicCloseAll(err)
+			}
+			seen := make(map[string]bool)
+			for _, entry := range entries {
+				name := entry.Name()
+				fullpath := filepath.Join(path, name)
+				seen[name] = true
+				if subdir, ok := it.Dirs[name]; ok {
+					report.checked()
+					if subdir.IsSymlink() && !isCorrectSymlink(subdir.Symlink, fullpath) {
+						report.drift(DriftModified, fullpath, "symlink", nil, subdir)
+					}
+					if !subdir.IsSymlink() && !entry.IsDir() {
+						report.drift(DriftModified, fullpath, "not a directory", nil, subdir)
+					}
+					continue
+				}
+				details, ok := it.Files[name]
+				if !ok {
+					report.drift(DriftAdded, fullpath, "extra", nil, nil)
+					continue
+				}
+				report.checked()
+				if details.IsSymlink() {
+					if !isCorrectSymlink(details.Symlink, fullpath) {
+						report.drift(DriftModified, fullpath, "symlink", details, nil)
+					}
+					continue
+				}
+				info, err := entry.Info()
+				switch {
+				case err != nil:
+					report.drift(DriftModified, fullpath, fmt.Sprintf("unreadable: %v", err), details, nil)
+				case info.IsDir():
+					report.drift(DriftModified, fullpath, "not a file", details, nil)
+				case !expectedMode(fs, details, info.Mode()):
+					report.drift(DriftModified, fullpath, "mode", details, nil)
+				case info.Size() != details.Size:
+					report.drift(DriftModified, fullpath, "size", details, nil)
+				default:
+					anywork.Backlog(verifyDrift(library, fs, report, fullpath, details))
+				}
+			}
+			for name, subdir := range it.Dirs {
+				if !seen[name] {
+					report.drift(DriftMissing, filepath.Join(path, name), "directory", nil, subdir)
+				}
+			}
+			for name, details := range it.Files {
+				if !seen[name] {
+					report.drift(DriftMissing, filepath.Join(path, name), "file", details, nil)
+				}
+			}
+		}
+	}
+}
+
+func spaceRelocation(library Library, fs *Root) {
+	if len(fs.Adopted) > 0 {
+		fs.relocation = newAdoptedRelocation(fs.Adopted, fs.Path)
+		return
+	}
+	tree, ok := library.(*hololib)
+	if !ok {
+		return
+	}
+	catalog, err := NewRoot(tree.Stage())
+	if err != nil || catalog.LoadHeaderFrom(tree.CatalogPath(fs.Blueprint)) != nil {
+		return
+	}
+	if filepath.Dir(catalog.Path) == fs.HolotreeBase() && len(catalog.Path) == len(fs.Path) {
+		return
+	}
+	fs.relocation = newRelocation(catalog.Path, fs.Path)
+}
+
+func VerifySpace(library Library, metafile string) (report *SpaceDrift, err error) {
+	defer fail.Around(&err)
+
+	common.TimelineBegin("holotree space verify %q", metafile)
+	defer common.TimelineEnd()
+
+	targetdir := metafile[:len(metafile)-len(filepath.Ext(metafile))]
+	fs, err := NewRoot(targetdir)
+	fail.On(err != nil, "Could not create root for %q, reason: %v", targetdir, err)
+	err = fs.LoadFrom(metafile)
+	fail.On(err != nil, "Could not load %q, reason: %v", metafile, err)
+	spaceRelocation(library, fs)
+	report = &SpaceDrift{
+		Identity:  fs.Identity,
+		Space:     fs.Space,
+		Path:      fs.Path,
+		Blueprint: fs.Blueprint,
+		Drifts:    make(Drifts, 0, 10),
+		root:      fs,
+	}
+	fail.On(!pathlib.IsDir(fs.Path), "Space directory %q does not exist.", fs.Path)
+	err = fs.AllDirs(VerifyDirectory(library, fs, report))
+	fail.On(err != nil, "Failed to verify space %q, reason: %v", fs.Path, err)
+	sort.SliceStable(report.Drifts, func(left, right int) bool {
+		return report.Drifts[left].Path < report.Drifts[right].Path
+	})
+	return report, nil
+}
+
+func healDrift(library Library, fs *Root, drift *Drift) anywork.Work {
+	switch {
+	case drift.Status == DriftAdded:
+		return RemoveDirectory(drift.fullpath)
+	case drift.dir != nil && drift.dir.IsSymlink():
+		return func() {
+			anywork.OnErrPanicCloseAll(restoreSymlink(drift.dir.Symlink, drift.fullpath))
+		}
+	case drift.dir != nil:
+		return func() {
+			os.RemoveAll(drift.fullpath)
+			anywork.OnErrPanicCloseAll(MakeBranches(drift.fullpath, drift.dir))
+			drift.dir.AllDirs(drift.fullpath, RestoreDirectory(library, fs, make(map[string]string), &stats{}))
+		}
+	default:
+		return func() {
+			if pathlib.IsDir(drift.fullpath) {
+				anywork.OnErrPanicCloseAll(TryRemoveAll("directory", drift.fullpath))
+			}
+			anywork.Backlog(dropFile(library, fs, drift.fullpath, drift.file))
+		}
+	}
+}
+
+func (it *SpaceDrift) Heal(library Library) (err error) {
+	defer fail.Around(&err)
+
+	common.TimelineBegin("holotree space heal %q", it.Path)
+	defer common.TimelineEnd()
+
+	completed := pathlib.LockWaitMessage("Serialized holotree heal [holotree base lock]")
+	locker, err := pathlib.Locker(it.Path+".lck", 30000)
+	completed()
+	fail.On(err != nil, "Could not get lock for %s. Quiting.", it.Path)
+	defer locker.Release()
+
+	protected := it.root.Protected
+	unprotectSpace(it.root)
+	for _, drift := range it.Drifts {
+		anywork.Backlog(healDrift(library, it.root, drift))
+	}
+	err = anywork.Sync()
+	fail.On(err != nil, "Failed to heal space %q, reason: %v", it.Path, err)
+	if protected {
+		it.root.Protected = true
+		err = it.root.AllDirs(ProtectDirectory(library))
+		fail.On(err != nil, "Failed to protect space %q, reason: %v", it.Path, err)
+	}
+	it.Healed = true
+	return nil
+}
@@ -0,0 +1,47 @@
+package htfs_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/robocorp/rcc/hamlet"
+	"github.com/robocorp/rcc/htfs"
+)
+
+func TestVerifySpaceReportsModifiedAddedAndMissingFiles(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	space := filepath.Join(t.TempDir(), "space")
+	must.Nil(os.MkdirAll(filepath.Join(space, "lib"), 0o755))
+	must.Nil(os.WriteFile(filepath.Join(space, "same.txt"), []byte("same"), 0o644))
+	must.Nil(os.WriteFile(filepath.Join(space, "changed.txt"), []byte("before"), 0o644))
+	must.Nil(os.WriteFile(filepath.Join(space, "lib", "removed.txt"), []byte("gone"), 0o644))
+
+	fs, err := htfs.NewRoot(space)
+	must.Nil(err)
+	must.Nil(fs.Lift())
+	must.Nil(fs.AllFiles(htfs.Locator(space)))
+	must.Nil(fs.SaveAs(space + ".meta"))
+
+	report, err := htfs.VerifySpace(nil, space+".meta")
+	must.Nil(err)
+	must.Equal(0, len(report.Drifts))
+
+	must.Nil(os.WriteFile(filepath.Join(space, "changed.txt"), []byte("after!"), 0o644))
+	must.Nil(os.WriteFile(filepath.Join(space, "added.txt"), []byte("new"), 0o644))
+	must.Nil(os.Remove(filepath.Join(space, "lib", "removed.txt")))
+
+	report, err = htfs.VerifySpace(nil, space+".meta")
+	must.Nil(err)
+	wont.True(report.Healed)
+	must.Equal(3, len(report.Drifts))
+	must.Equal(1, report.Drifts.Count(htfs.DriftModified))
+	must.Equal(1, report.Drifts.Count(htfs.DriftAdded))
+	must.Equal(1, report.Drifts.Count(htfs.DriftMissing))
+
+	must.Equal("added.txt", report.Drifts[0].Path)
+	must.Equal("changed.txt", report.Drifts[1].Path)
+	must.Equal("content", report.Drifts[1].Reason)
+	must.Equal(filepath.Join("lib", "removed.txt"), report.Drifts[2].Path)
+}
@@ -25,6 +25,14 @@ func Virtual() MutableLibrary {
 	}
 }
 
+// privateVirtual has stage of its own (with same path length as shared one),
+// so that other builds do not clean it up while it is in use.
+func privateVirtual(seed string) MutableLibrary {
+	return &virtual{
+		identity: sipit([]byte(common.RobocorpHome() + seed)),
+	}
+}
+
 func (it *virtual) Identity() string {
 	suffix := fmt.Sprintf("%016x", it.identity)
 	return fmt.Sprintf("v%s_%sh", common.UserHomeIdentity(), suffix[:14])
@@ -58,6 +66,7 @@ func (it *virtual) Record(blueprint []byte) (err error) {
 	common.Timeline("holotree record start %s (virtual)", key)
 	fs, err := NewRoot(it.Stage())
 	fail.On(err != nil, "Failed to create stage root: %v", err)
+	fs.Bytecode = bytecodePolicy(blueprint)
 	err = fs.Lift()
 	fail.On(err != nil, "Failed to lift structure out of stage: %v", err)
 	common.Timeline("holotree (re)locator start (virtual)")
@@ -82,9 +91,7 @@ func (it *virtual) Restore(blueprint, client, tag []byte) (string, error) {
 	key := BlueprintHash(blueprint)
 	common.Timeline("holotree restore start %s (virtual)", key)
 	name := ControllerSpaceName(client, tag)
-	metafile := filepath.Join(common.HolotreeLocation(), fmt.Sprintf("%s.meta", name))
-	targetdir := filepath.Join(common.HolotreeLocation(), name)
-	lockfile := filepath.Join(common.HolotreeLocation(), fmt.Sprintf("%s.lck", name))
+	metafile, targetdir, lockfile := SpaceFiles(common.HolotreeLocation(), name)
 	completed := pathlib.LockWaitMessage("Serialized holotree restore [holotree virtual lock]")
 	locker, err := pathlib.Locker(lockfile, 30000)
 	completed()
@@ -92,17 +99,20 @@ func (it *virtual) Restore(blueprint, client, tag []byte) (string, error) {
 	defer locker.Release()
 	journal.Post("space-used", metafile, "virutal holotree with blueprint %s", key)
 	currentstate := make(map[string]string)
+	var previous *Root
 	shadow, err := NewRoot(targetdir)
 	if err == nil {
 		err = shadow.LoadFrom(metafile)
 	}
 	if err == nil {
+		previous = shadow
 		common.Timeline("holotree digest start (virtual)")
 		shadow.Treetop(DigestRecorder(currentstate))
 		common.Timeline("holotree digest done (virtual)")
 	}
 	fs := it.root
-	err = fs.Relocate(targetdir)
+	protect := protecting(it, previous)
+	err = relocateSpace(fs, previous, targetdir)
 	if err != nil {
 		return "", err
 	}
@@ -122,6 +132,14 @@ func (it *virtual) Restore(blueprint, client, tag []byte) (string, error) {
 	defer common.Timeline("- dirty %d/%d", score.dirty, score.total)
 	common.Debug("Holotree dirty workload: %d/%d\n", score.dirty, score.total)
 	journal.CurrentBuildEvent().Dirty(score.Dirtyness())
+	err = fs.RelocationReport()
+	if err != nil {
+		return "", err
+	}
+	err = protect(fs)
+	if err != nil {
+		return "", err
+	}
 	fs.Controller = string(client)
 	fs.Space = string(tag)
 	err = fs.SaveAs(metafile)
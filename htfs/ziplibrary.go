@@ -2,7 +2,6 @@ package htfs
 
 import (
 	"archive/zip"
-	"compress/gzip"
 	"fmt"
 	"io"
 	"path/filepath"
@@ -58,7 +57,7 @@ func (it *ziplibrary) openFile(filename string) (readable io.Reader, closer Clos
 	if err != nil {
 		return nil, nil, err
 	}
-	wrapper, err := gzip.NewReader(file)
+	wrapper, err := Decompressed(file)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -74,8 +73,15 @@ func (it *ziplibrary) Open(digest string) (readable io.Reader, closer Closer, er
 	return it.openFile(filename)
 }
 
+// CatalogPath falls back to legacy catalog, since zips made by older rcc
+// versions have only those, and both formats are readable.
 func (it *ziplibrary) CatalogPath(key string) string {
-	return filepath.Join("catalog", CatalogName(key))
+	catalog := filepath.Join("catalog", CatalogName(key))
+	legacy := filepath.Join("catalog", legacyCatalogName(key))
+	if _, ok := it.lookup[catalog]; !ok && it.lookup[legacy] != nil {
+		return legacy
+	}
+	return catalog
 }
 
 func (it *ziplibrary) TargetDir(blueprint, client, tag []byte) (path string, err error) {
@@ -102,14 +108,14 @@ func (it *ziplibrary) Restore(blueprint, client, tag []byte) (result string, err
 	fs, err := NewRoot(".")
 	fail.On(err != nil, "Failed to create root -> %v", err)
 	catalog := it.CatalogPath(key)
+	err = it.verifyCatalog(catalog)
+	fail.On(err != nil, "%v", err)
 	reader, closer, err := it.openFile(catalog)
 	fail.On(err != nil, "Failed to open catalog %q -> %v", catalog, err)
 	defer closer()
 	err = fs.ReadFrom(reader)
 	fail.On(err != nil, "Failed to read catalog %q -> %v", catalog, err)
-	metafile := filepath.Join(fs.HolotreeBase(), fmt.Sprintf("%s.meta", name))
-	targetdir := filepath.Join(fs.HolotreeBase(), name)
-	lockfile := filepath.Join(fs.HolotreeBase(), fmt.Sprintf("%s.lck", name))
+	metafile, targetdir, lockfile := SpaceFiles(fs.HolotreeBase(), name)
 	completed := pathlib.LockWaitMessage("Serialized holotree restore [holotree base lock]")
 	locker, err := pathlib.Locker(lockfile, 30000)
 	completed()
@@ -117,17 +123,21 @@ func (it *ziplibrary) Restore(blueprint, client, tag []byte) (result string, err
 	defer locker.Release()
 	journal.Post("space-used", metafile, "zipped holotree with blueprint %s from %s", key, catalog)
 	currentstate := make(map[string]string)
+	var previous *Root
 	shadow, err := NewRoot(targetdir)
 	if err == nil {
 		err = shadow.LoadFrom(metafile)
 	}
 	if err == nil {
+		previous = shadow
 		common.TimelineBegin("holotree digest start (zip)")
 		shadow.Treetop(DigestRecorder(currentstate))
 		common.TimelineEnd()
 	}
-	err = fs.Relocate(targetdir)
+	protect := protecting(it, previous)
+	err = relocateSpace(fs, previous, targetdir)
 	fail.On(err != nil, "Failed to relocate %q -> %v", targetdir, err)
+	swap := swapping(fs, targetdir, currentstate)
 	common.TimelineBegin("holotree make branches start (zip)")
 	err = fs.Treetop(MakeBranches)
 	common.TimelineEnd()
@@ -140,8 +150,15 @@ func (it *ziplibrary) Restore(blueprint, client, tag []byte) (result string, err
 	defer common.Timeline("- dirty %d/%d", score.dirty, score.total)
 	common.Debug("Holotree dirty workload: %d/%d\n", score.dirty, score.total)
 	journal.CurrentBuildEvent().Dirty(score.Dirtyness())
+	err = fs.RelocationReport()
+	fail.On(err != nil, "%v", err)
+	err = swap()
+	fail.On(err != nil, "Failed to swap in %q -> %v", targetdir, err)
+	err = protect(fs)
+	fail.On(err != nil, "Failed to protect %q -> %v", targetdir, err)
 	fs.Controller = string(client)
 	fs.Space = string(tag)
+	fs.Pool, fs.PoolSize = poolMembership(string(tag))
 	err = fs.SaveAs(metafile)
 	fail.On(err != nil, "Failed to save metafile %q -> %v", metafile, err)
 	return targetdir, nil
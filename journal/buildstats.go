@@ -39,6 +39,7 @@ type (
 		Controller    string `json:"controller"`
 		Space         string `json:"space"`
 		BlueprintHash string `json:"blueprint"`
+		Layer         string `json:"layer,omitempty"`
 
 		Started         float64 `json:"started"`
 		Prepared        float64 `json:"prepared"`
@@ -94,6 +95,10 @@ func failed(the *BuildEvent) bool {
 	return the.Build && !the.Success
 }
 
+func layered(the *BuildEvent) bool {
+	return len(the.Layer) > 0
+}
+
 func build(the *BuildEvent) bool {
 	return the.Build
 }
@@ -281,6 +286,12 @@ func MakeStatistics(weeks uint, assistants, robots, prepares, variables bool) (i
 		theCounts(robotStats, build),
 		theCounts(variableStats, build),
 		theCounts(stats, build)))
+	tabbed.Write(tabs("Layered builds",
+		theCounts(assistantStats, layered),
+		theCounts(prepareStats, layered),
+		theCounts(robotStats, layered),
+		theCounts(variableStats, layered),
+		theCounts(stats, layered)))
 	tabbed.Write(tabs("Forced builds ",
 		theCounts(assistantStats, forced),
 		theCounts(prepareStats, forced),
@@ -446,6 +457,12 @@ func (it *BuildEvent) PrepareComplete() {
 	buildevent.Prepared = it.stowatch()
 }
 
+func (it *BuildEvent) LayerRestored(layer string) {
+	buildevent.Build = true
+	buildevent.Layer = layer
+	buildevent.MicromambaDone = it.stowatch()
+}
+
 func (it *BuildEvent) MicromambaComplete() {
 	buildevent.Build = true
 	buildevent.MicromambaDone = it.stowatch()
@@ -93,12 +93,25 @@ func RunDiagnostics() *common.DiagnosticStatus {
 	result.Details["hololib-catalog-location"] = common.HololibCatalogLocation()
 	result.Details["hololib-library-location"] = common.HololibLibraryLocation()
 	result.Details["holotree-location"] = common.HolotreeLocation()
+	result.Details["holotree-restore-mode"] = htfs.RestoreMode()
+	result.Details["holotree-signature-policy"] = htfs.SignaturePolicy()
+	result.Details["holotree-prune-unused-days"] = fmt.Sprintf("%d", settings.Global.HolotreePruneUnusedDays())
+	result.Details["holotree-prune-keep-per-controller"] = fmt.Sprintf("%d", settings.Global.HolotreePruneKeepPerController())
+	result.Details["holotree-max-hololib-size"] = fmt.Sprintf("%dM", settings.Global.HolotreeMaxLibrarySize())
 	result.Details["holotree-shared"] = fmt.Sprintf("%v", common.SharedHolotree)
 	result.Details["holotree-user-id"] = common.UserHomeIdentity()
 	result.Details["os"] = common.Platform()
 	result.Details["cpus"] = fmt.Sprintf("%d", runtime.NumCPU())
 	result.Details["when"] = time.Now().Format(time.RFC3339 + " (MST)")
 	result.Details["no-build"] = fmt.Sprintf("%v", settings.Global.NoBuild())
+	result.Details["no-conda-layers"] = fmt.Sprintf("%v", settings.Global.NoCondaLayers())
+	result.Details["swap-restore"] = fmt.Sprintf("%v", settings.Global.SwapRestore())
+	result.Details["protect-spaces"] = fmt.Sprintf("%v", settings.Global.ProtectSpaces())
+	result.Details["precompile-bytecode"] = fmt.Sprintf("%v", settings.Global.PrecompileBytecode())
+
+	for blueprint, directory := range htfs.AdoptedCatalogs() {
+		result.Details[fmt.Sprintf("hololib-adopted-%s", blueprint)] = directory
+	}
 
 	for name, filename := range lockfiles() {
 		result.Details[name] = filename
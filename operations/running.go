@@ -19,6 +19,9 @@ import (
 var (
 	rcHosts  = []string{"RC_API_SECRET_HOST", "RC_API_WORKITEM_HOST"}
 	rcTokens = []string{"RC_API_SECRET_TOKEN", "RC_API_WORKITEM_TOKEN"}
+
+	// spaceUser is never released explicitly, it goes away when rcc exits
+	spaceUser pathlib.Releaser
 )
 
 type RunFlags struct {
@@ -116,10 +119,17 @@ func LoadTaskWithEnvironment(packfile, theTask string, force bool) (bool, robot.
 		return true, config, todo, ""
 	}
 
+	if common.SpacePool == 0 {
+		common.SpacePool = config.SpacePool()
+	}
 	label, _, err := htfs.NewEnvironment(config.CondaConfigFile(), config.Holozip(), true, force)
 	if err != nil {
 		pretty.Exit(4, "Error: %v", err)
 	}
+	spaceUser, err = htfs.UseSpace(label)
+	if err != nil {
+		pretty.Warning("Could not mark space %q as used, reason: %v", label, err)
+	}
 	return false, config, todo, label
 }
 
@@ -282,9 +292,22 @@ func ExecuteTask(flags *RunFlags, template []string, config robot.Robot, todo ro
 		_, err = shell.New(environment, directory, task...).Tee(outputDir, interactive)
 	}
 	journal.CurrentBuildEvent().RobotEnds()
+	htfs.MarkSpaceRun(label)
+	// pruning is deferred until results and exit code of run are settled
+	defer htfs.PruneOpportunistically()
 	after := make(map[string]string)
 	afterHash, afterErr := conda.DigestFor(label, after)
 	conda.DiagnoseDirty(label, label, beforeHash, afterHash, beforeErr, afterErr, before, after, true)
+	protected := htfs.ProtectedSpace(label)
+	if protected && beforeErr == nil && afterErr == nil {
+		dirty := conda.DirtyFolders(before, after)
+		if len(dirty) > 0 {
+			pretty.Exit(13, "Error: robot run modified protected space %q, first offending path is %q (and %d more).", label, dirty[0], len(dirty)-1)
+		}
+	}
+	if err != nil && protected {
+		pretty.Note("Space %q is protected (read-only), so robot attempts to modify it will fail with permission errors.", label)
+	}
 	if err != nil {
 		pretty.Exit(10, "Error: %v", err)
 	}
@@ -0,0 +1,71 @@
+//go:build darwin || linux || !windows
+// +build darwin linux !windows
+
+package pathlib_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/robocorp/rcc/hamlet"
+	"github.com/robocorp/rcc/pathlib"
+)
+
+func lockedWithin(delay time.Duration, lock func() (pathlib.Releaser, error)) (chan pathlib.Releaser, bool) {
+	result := make(chan pathlib.Releaser, 1)
+	go func() {
+		locker, _ := lock()
+		result <- locker
+	}()
+	select {
+	case locker := <-result:
+		result <- locker
+		return result, true
+	case <-time.After(delay):
+		return result, false
+	}
+}
+
+func TestSharedLocksExcludeOnlyExclusiveLocks(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	lockfile := filepath.Join(t.TempDir(), "shared.lck")
+	first, err := pathlib.SharedLocker(lockfile, 30000)
+	must.Nil(err)
+
+	shared, ok := lockedWithin(2*time.Second, func() (pathlib.Releaser, error) {
+		return pathlib.SharedLocker(lockfile, 30000)
+	})
+	must.True(ok)
+
+	exclusive, ok := lockedWithin(200*time.Millisecond, func() (pathlib.Releaser, error) {
+		return pathlib.Locker(lockfile, 30000)
+	})
+	wont.True(ok)
+
+	must.Nil(first.Release())
+	must.Nil((<-shared).Release())
+	select {
+	case locker := <-exclusive:
+		must.Nil(locker.Release())
+	case <-time.After(2 * time.Second):
+		t.Fatal("exclusive lock was not acquired after shared locks were released")
+	}
+}
+
+func TestTryLockerFailsWhileFileIsInUse(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	lockfile := filepath.Join(t.TempDir(), "space.use")
+	user, err := pathlib.UsageLocker(lockfile)
+	must.Nil(err)
+
+	_, ok := pathlib.TryLocker(lockfile)
+	wont.True(ok)
+
+	must.Nil(user.Release())
+	locker, ok := pathlib.TryLocker(lockfile)
+	must.True(ok)
+	must.Nil(locker.Release())
+}
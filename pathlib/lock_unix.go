@@ -12,6 +12,23 @@ import (
 )
 
 func Locker(filename string, trycount int) (Releaser, error) {
+	return locker(filename, syscall.LOCK_EX, os.O_TRUNC)
+}
+
+func SharedLocker(filename string, trycount int) (Releaser, error) {
+	return locker(filename, syscall.LOCK_SH, 0)
+}
+
+func UsageLocker(filename string) (Releaser, error) {
+	return locker(filename, syscall.LOCK_SH, 0)
+}
+
+func TryLocker(filename string) (Releaser, bool) {
+	releaser, err := locker(filename, syscall.LOCK_EX|syscall.LOCK_NB, 0)
+	return releaser, err == nil
+}
+
+func locker(filename string, how, truncate int) (Releaser, error) {
 	if Lockless {
 		return Fake(), nil
 	}
@@ -23,7 +40,7 @@ func Locker(filename string, trycount int) (Releaser, error) {
 	if err != nil {
 		return nil, err
 	}
-	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o666)
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|truncate, 0o666)
 	if err != nil {
 		return nil, err
 	}
@@ -31,14 +48,17 @@ func Locker(filename string, trycount int) (Releaser, error) {
 	if err != nil {
 		return nil, err
 	}
-	err = syscall.Flock(int(file.Fd()), int(syscall.LOCK_EX))
+	err = syscall.Flock(int(file.Fd()), how)
 	if err != nil {
+		file.Close()
 		return nil, err
 	}
 	marker := lockPidFilename(filename)
-	_, err = file.Write([]byte(marker))
-	if err != nil {
-		return nil, err
+	if how&syscall.LOCK_EX != 0 {
+		_, err = file.Write([]byte(marker))
+		if err != nil {
+			return nil, err
+		}
 	}
 	common.Debug("LOCKER: make marker %v", marker)
 	ForceTouchWhen(marker, time.Now())
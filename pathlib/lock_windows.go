@@ -9,13 +9,16 @@ import (
 	"time"
 
 	"github.com/robocorp/rcc/common"
+	"golang.org/x/sys/windows"
 )
 
 const (
-	LOCKFILE_EXCLUSIVE_LOCK = 2
+	LOCKFILE_FAIL_IMMEDIATELY = 1
+	LOCKFILE_EXCLUSIVE_LOCK   = 2
 )
 
 // https://docs.microsoft.com/en-us/windows/win32/api/fileapi/nf-fileapi-lockfile
+// https://docs.microsoft.com/en-us/windows/win32/api/fileapi/nf-fileapi-lockfileex
 // https://docs.microsoft.com/en-us/windows/win32/api/fileapi/nf-fileapi-unlockfile
 
 var (
@@ -28,6 +31,64 @@ type filehandle interface {
 	Fd() uintptr
 }
 
+// SharedLocker uses LockFileEx without exclusive flag, so it shares same
+// region with other shared lockers, but conflicts with exclusive LockFile.
+func SharedLocker(filename string, trycount int) (Releaser, error) {
+	if Lockless {
+		return Fake(), nil
+	}
+	common.Trace("LOCKER: Want shared lock on: %v", filename)
+	_, err := EnsureSharedParentDirectory(filename)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE, 0o666)
+	if err != nil {
+		return nil, err
+	}
+	_, err = shared.MakeSharedFile(filename)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	for {
+		trycount -= 1
+		success, err := trysharedlock(file)
+		if err != nil && trycount < 0 {
+			file.Close()
+			return nil, err
+		}
+		if success {
+			marker := lockPidFilename(filename)
+			common.Debug("LOCKER: make marker %v", marker)
+			ForceTouchWhen(marker, time.Now())
+			return &Locked{file, marker}, nil
+		}
+		time.Sleep(40 * time.Millisecond)
+	}
+}
+
+// Open files already prevent renaming and removing on Windows, so usage is lockless.
+func UsageLocker(filename string) (Releaser, error) {
+	return Fake(), nil
+}
+
+func TryLocker(filename string) (Releaser, bool) {
+	if Lockless {
+		return Fake(), true
+	}
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE, 0o666)
+	if err != nil {
+		return nil, false
+	}
+	success, _ := trylock(lockFile, file)
+	if !success {
+		file.Close()
+		return nil, false
+	}
+	return &Locked{file, lockPidFilename(filename)}, true
+}
+
 func Locker(filename string, trycount int) (Releaser, error) {
 	if Lockless {
 		return Fake(), nil
@@ -88,6 +149,15 @@ func (it Locked) Release() error {
 	return err
 }
 
+func trysharedlock(identity filehandle) (bool, error) {
+	handle := windows.Handle(identity.Fd())
+	err := windows.LockFileEx(handle, LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, &windows.Overlapped{})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func trylock(tool uintptr, identity filehandle) (bool, error) {
 	handle := syscall.Handle(identity.Fd())
 	primary, _, err := syscall.Syscall6(
@@ -36,6 +36,7 @@ type Robot interface {
 	RootDirectory() string
 	HasHolozip() bool
 	Holozip() string
+	SpacePool() int
 	Validate() (bool, error)
 	Diagnostics(*common.DiagnosticStatus, bool)
 	DependenciesFile() (string, bool)
@@ -63,6 +64,7 @@ type robot struct {
 	Artifacts    string           `yaml:"artifactsDir"`
 	Path         []string         `yaml:"PATH"`
 	Pythonpath   []string         `yaml:"PYTHONPATH"`
+	Pool         int              `yaml:"spacePool,omitempty"`
 	Root         string
 }
 
@@ -290,6 +292,10 @@ func (it *robot) HasHolozip() bool {
 	return len(it.Holozip()) > 0
 }
 
+func (it *robot) SpacePool() int {
+	return it.Pool
+}
+
 func (it *robot) Holozip() string {
 	zippath := filepath.Join(it.Root, "hololib.zip")
 	if pathlib.IsFile(zippath) {
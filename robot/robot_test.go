@@ -87,6 +87,19 @@ func TestCanReadRealRobotYaml(t *testing.T) {
 	must.Nil(err)
 }
 
+func TestCanReadSpacePool(t *testing.T) {
+	must, wont := hamlet.Specifications(t)
+
+	sut, err := robot.LoadRobotYaml("testdata/pool.yaml", false)
+	must.Nil(err)
+	wont.Nil(sut)
+	must.Equal(3, sut.SpacePool())
+
+	sut, err = robot.LoadRobotYaml("testdata/robot.yaml", false)
+	must.Nil(err)
+	must.Equal(0, sut.SpacePool())
+}
+
 func TestCanGetShellFormCommand(t *testing.T) {
 	must, wont := hamlet.Specifications(t)
 
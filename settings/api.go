@@ -29,10 +29,23 @@ type Api interface {
 	ConfiguredHttpTransport() *http.Transport
 	HttpsProxy() string
 	HttpProxy() string
+	HolotreeRestoreMode() string
+	HolotreeCodec() string
+	HolotreeCodecLevel() int
+	HolotreeRemoteLibrary() string
+	HolotreeSignaturePolicy() string
+	HolotreeTrustedKeys() []string
+	HolotreePruneUnusedDays() int
+	HolotreePruneKeepPerController() int
+	HolotreeMaxLibrarySize() int
 	HasPipRc() bool
 	HasMicroMambaRc() bool
 	HasCaBundle() bool
 	VerifySsl() bool
 	NoRevocation() bool
 	NoBuid() bool
+	NoCondaLayers() bool
+	SwapRestore() bool
+	ProtectSpaces() bool
+	PrecompileBytecode() bool
 }
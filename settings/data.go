@@ -33,6 +33,7 @@ func (it SettingsLayers) Effective() *Settings {
 		Branding:     make(StringMap),
 		Certificates: &Certificates{},
 		Network:      &Network{},
+		Holotree:     &Holotree{},
 		Endpoints:    make(StringMap),
 		Options:      make(BoolMap),
 		Hosts:        make([]string, 0, 100),
@@ -56,6 +57,7 @@ type Settings struct {
 	Branding     StringMap     `yaml:"branding,omitempty" json:"branding,omitempty"`
 	Certificates *Certificates `yaml:"certificates,omitempty" json:"certificates,omitempty"`
 	Network      *Network      `yaml:"network,omitempty" json:"network,omitempty"`
+	Holotree     *Holotree     `yaml:"holotree,omitempty" json:"holotree,omitempty"`
 	Endpoints    StringMap     `yaml:"endpoints,omitempty" json:"endpoints,omitempty"`
 	Hosts        []string      `yaml:"diagnostics-hosts,omitempty" json:"diagnostics-hosts,omitempty"`
 	Options      BoolMap       `yaml:"options,omitempty" json:"options,omitempty"`
@@ -110,6 +112,9 @@ func (it *Settings) onTopOf(target *Settings) {
 	if it.Network != nil {
 		it.Network.onTopOf(target)
 	}
+	if it.Holotree != nil {
+		it.Holotree.onTopOf(target)
+	}
 	if it.Meta != nil {
 		it.Meta.onTopOf(target)
 	}
@@ -340,3 +345,48 @@ func (it *Network) onTopOf(target *Settings) {
 		target.Network.HttpProxy = it.HttpProxy
 	}
 }
+
+type Holotree struct {
+	RestoreMode string   `yaml:"restore-mode,omitempty" json:"restore-mode,omitempty"`
+	Codec       string   `yaml:"codec,omitempty" json:"codec,omitempty"`
+	CodecLevel  int      `yaml:"codec-level,omitempty" json:"codec-level,omitempty"`
+	RemoteLib   string   `yaml:"remote-hololib,omitempty" json:"remote-hololib,omitempty"`
+	Signatures  string   `yaml:"signature-policy,omitempty" json:"signature-policy,omitempty"`
+	TrustedKeys []string `yaml:"trusted-keys,omitempty" json:"trusted-keys,omitempty"`
+	PruneDays   int      `yaml:"prune-unused-days,omitempty" json:"prune-unused-days,omitempty"`
+	PruneKeep   int      `yaml:"prune-keep-per-controller,omitempty" json:"prune-keep-per-controller,omitempty"`
+	MaxLibrary  int      `yaml:"max-hololib-size,omitempty" json:"max-hololib-size,omitempty"`
+}
+
+func (it *Holotree) onTopOf(target *Settings) {
+	if target.Holotree == nil {
+		target.Holotree = &Holotree{}
+	}
+	if len(it.RestoreMode) > 0 {
+		target.Holotree.RestoreMode = it.RestoreMode
+	}
+	if len(it.Codec) > 0 {
+		target.Holotree.Codec = it.Codec
+	}
+	if it.CodecLevel > 0 {
+		target.Holotree.CodecLevel = it.CodecLevel
+	}
+	if len(it.RemoteLib) > 0 {
+		target.Holotree.RemoteLib = it.RemoteLib
+	}
+	if len(it.Signatures) > 0 {
+		target.Holotree.Signatures = it.Signatures
+	}
+	if len(it.TrustedKeys) > 0 {
+		target.Holotree.TrustedKeys = it.TrustedKeys
+	}
+	if it.PruneDays > 0 {
+		target.Holotree.PruneDays = it.PruneDays
+	}
+	if it.PruneKeep > 0 {
+		target.Holotree.PruneKeep = it.PruneKeep
+	}
+	if it.MaxLibrary > 0 {
+		target.Holotree.MaxLibrary = it.MaxLibrary
+	}
+}
@@ -193,6 +193,43 @@ func (it gateway) HttpsProxy() string {
 func (it gateway) HttpProxy() string {
 	return it.settings().Network.HttpProxy
 }
+
+func (it gateway) HolotreeRestoreMode() string {
+	return it.settings().Holotree.RestoreMode
+}
+
+func (it gateway) HolotreeCodec() string {
+	return it.settings().Holotree.Codec
+}
+
+func (it gateway) HolotreeCodecLevel() int {
+	return it.settings().Holotree.CodecLevel
+}
+
+func (it gateway) HolotreeRemoteLibrary() string {
+	return it.settings().Holotree.RemoteLib
+}
+
+func (it gateway) HolotreeSignaturePolicy() string {
+	return it.settings().Holotree.Signatures
+}
+
+func (it gateway) HolotreeTrustedKeys() []string {
+	return it.settings().Holotree.TrustedKeys
+}
+
+func (it gateway) HolotreePruneUnusedDays() int {
+	return it.settings().Holotree.PruneDays
+}
+
+func (it gateway) HolotreePruneKeepPerController() int {
+	return it.settings().Holotree.PruneKeep
+}
+
+func (it gateway) HolotreeMaxLibrarySize() int {
+	return it.settings().Holotree.MaxLibrary
+}
+
 func (it gateway) HasPipRc() bool {
 	return pathlib.IsFile(common.PipRcFile())
 }
@@ -245,6 +282,22 @@ func (it gateway) NoBuild() bool {
 	return nobuild || common.NoBuild || it.Option("no-build")
 }
 
+func (it gateway) NoCondaLayers() bool {
+	return it.Option("no-conda-layers")
+}
+
+func (it gateway) SwapRestore() bool {
+	return common.SwapRestore || it.Option("swap-restore")
+}
+
+func (it gateway) PrecompileBytecode() bool {
+	return it.Option("precompile-bytecode")
+}
+
+func (it gateway) ProtectSpaces() bool {
+	return common.ProtectSpaces || it.Option("protect-spaces")
+}
+
 func (it gateway) ConfiguredHttpTransport() *http.Transport {
 	return httpTransport
 }